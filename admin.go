@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+// requireAdmin checks with Telegram that the sender administers the chat and
+// tells them off if not
+func (c *casinoController) requireAdmin(ctx context.Context, b BotInterface, update *models.Update) bool {
+	member, err := b.GetChatMember(ctx, &bot.GetChatMemberParams{
+		ChatID: update.Message.Chat.ID,
+		UserID: update.Message.From.ID,
+	})
+	if err != nil {
+		log.Printf("error getting chat member: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   "Error checking admin rights.",
+		})
+		return false
+	}
+
+	if member.Type != models.ChatMemberTypeOwner && member.Type != models.ChatMemberTypeAdministrator {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   "Only group admins can do that.",
+		})
+		return false
+	}
+	return true
+}
+
+// auditAdminAction records a change made by an admin within tx
+func (c *casinoController) auditAdminAction(tx *gorm.DB, update *models.Update, action string, targetID int64, details string) error {
+	return c.db.CreateAdminAction(tx, &AdminAction{
+		GroupID:   update.Message.Chat.ID,
+		AdminID:   update.Message.From.ID,
+		AdminName: update.Message.From.Username,
+		Action:    action,
+		TargetID:  targetID,
+		Details:   details,
+		CreatedAt: c.clock.Now(),
+	})
+}
+
+// parseUserAmount parses "<command> @username <amount>"
+func parseUserAmount(text, command string) (string, int64, bool) {
+	args := strings.Fields(strings.TrimPrefix(text, command))
+	if len(args) != 2 {
+		return "", 0, false
+	}
+	amount, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.TrimPrefix(args[0], "@"), amount, true
+}
+
+func (c *casinoController) addBalanceHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	c.adjustBalance(ctx, b, update, "/addBalance")
+}
+
+func (c *casinoController) setBalanceHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	c.adjustBalance(ctx, b, update, "/setBalance")
+}
+
+// adjustBalance implements /addBalance (relative) and /setBalance (absolute)
+func (c *casinoController) adjustBalance(ctx context.Context, b BotInterface, update *models.Update, command string) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+
+	if !c.requireAdmin(ctx, b, update) {
+		return
+	}
+
+	username, amount, ok := parseUserAmount(update.Message.Text, command)
+	if !ok || (command == "/setBalance" && amount < 0) {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   fmt.Sprintf("Usage: %s @username <amount>", command),
+		})
+		return
+	}
+
+	user, err := c.db.FindUserByUsername(groupID, username)
+	if err == gorm.ErrRecordNotFound {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "User not found.",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error finding user: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error finding user.",
+		})
+		return
+	}
+
+	if _, err := c.db.GetOrCreateBalance(user.UserID, groupID); err != nil {
+		log.Printf("error getting balance: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting balance.",
+		})
+		return
+	}
+
+	var reply string
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		balance, err := c.db.GetBalance(tx, user.UserID, groupID)
+		if err != nil {
+			return err
+		}
+		// Deductions can't take a balance below zero
+		if command == "/addBalance" && balance.Amount+amount < 0 {
+			reply = fmt.Sprintf("@%s only has %d$, that would leave a negative balance.", username, balance.Amount)
+			return nil
+		}
+
+		entry := LedgerEntry{
+			UserID:    user.UserID,
+			GroupID:   groupID,
+			Delta:     amount,
+			Reason:    ledgerAdminGrant,
+			MessageID: update.Message.ID,
+			CreatedAt: c.clock.Now(),
+		}
+		if command == "/setBalance" {
+			entry.Reason = ledgerAdminSet
+			if err := c.db.SetBalance(tx, entry); err != nil {
+				return err
+			}
+		} else if err := c.db.UpdateBalance(tx, entry); err != nil {
+			return err
+		}
+		if err := c.auditAdminAction(tx, update, strings.TrimPrefix(command, "/"), user.UserID, fmt.Sprintf("%d", amount)); err != nil {
+			return err
+		}
+		if balance, err = c.db.GetBalance(tx, user.UserID, groupID); err != nil {
+			return err
+		}
+		reply = fmt.Sprintf("@%s now has %d$.", username, balance.Amount)
+		return nil
+	})
+	if err != nil {
+		log.Printf("error updating balance: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error updating balance.",
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   reply,
+	})
+}
+
+func (c *casinoController) resetUserHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+
+	if !c.requireAdmin(ctx, b, update) {
+		return
+	}
+
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/resetUser"))
+	if len(args) != 1 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Usage: /resetUser @username",
+		})
+		return
+	}
+	username := strings.TrimPrefix(args[0], "@")
+
+	user, err := c.db.FindUserByUsername(groupID, username)
+	if err == gorm.ErrRecordNotFound {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "User not found.",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error finding user: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error finding user.",
+		})
+		return
+	}
+
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		if err := c.db.ResetUser(tx, user.UserID, groupID, c.clock.Now()); err != nil {
+			return err
+		}
+		return c.auditAdminAction(tx, update, "resetUser", user.UserID, "")
+	}); err != nil {
+		log.Printf("error resetting user: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error resetting user.",
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   fmt.Sprintf("@%s's stats and balance have been reset.", username),
+	})
+}
+
+func (c *casinoController) resetGroupHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+
+	if !c.requireAdmin(ctx, b, update) {
+		return
+	}
+
+	// Wiping a whole group is drastic enough to ask twice
+	if strings.TrimSpace(strings.TrimPrefix(update.Message.Text, "/resetGroup")) != "confirm" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "This wipes every stat, balance and open duel in this group. Type /resetGroup confirm to proceed.",
+		})
+		return
+	}
+
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		if err := c.db.ResetGroup(tx, groupID, c.clock.Now()); err != nil {
+			return err
+		}
+		return c.auditAdminAction(tx, update, "resetGroup", 0, "")
+	}); err != nil {
+		log.Printf("error resetting group: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error resetting group.",
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   "The casino has been reset. Everyone starts from zero.",
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+// detectDiceCheat returns a dice message that wasn't rolled in this chat by
+// its sender, together with how it was faked. Telegram only randomizes dice
+// when they are sent, so forwarded, bot-relayed and edited dice carry a value
+// somebody picked.
+func detectDiceCheat(update *models.Update) (*models.Message, string) {
+	if msg := update.EditedMessage; msg != nil && msg.Dice != nil {
+		return msg, "an edited"
+	}
+
+	msg := update.Message
+	if msg == nil || msg.Dice == nil {
+		return nil, ""
+	}
+	if msg.ForwardOrigin != nil {
+		return msg, "a forwarded"
+	}
+	if msg.ViaBot != nil {
+		return msg, "a bot-sent"
+	}
+	return nil, ""
+}
+
+// handleDiceCheat counts the attempt against the sender and calls them out
+// in the group
+func (c *casinoController) handleDiceCheat(ctx context.Context, b BotInterface, msg *models.Message, how string) {
+	if msg.From == nil {
+		return
+	}
+
+	userID := msg.From.ID
+	groupID := msg.Chat.ID
+
+	if _, err := c.db.GetOrCreateStats(userID, groupID, msg.From.Username); err != nil {
+		log.Printf("error getting user: %v", err)
+		return
+	}
+
+	var attempts int64
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		attempts, err = c.db.RecordCheatAttempt(tx, userID, groupID)
+		return err
+	}); err != nil {
+		log.Printf("error recording cheat attempt: %v", err)
+		return
+	}
+
+	name := msg.From.Username
+	if name == "" {
+		name = fmt.Sprintf("User_%d", userID)
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text: fmt.Sprintf("🚨 @%s tried to pass off %s %s as their own roll. Nice try! No payout, and that's cheat attempt #%d.",
+			name, how, msg.Dice.Emoji, attempts),
+		ReplyParameters: &models.ReplyParameters{MessageID: msg.ID},
+	})
+}
+
+// cheatersHandler lists everyone caught cheating in the group to admins
+func (c *casinoController) cheatersHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if !c.requireAdmin(ctx, b, update) {
+		return
+	}
+
+	stats, err := c.db.GetStatsByGroup(update.Message.Chat.ID)
+	if err != nil {
+		log.Printf("error getting users: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   "Error getting stats.",
+		})
+		return
+	}
+
+	var cheaters []SlotMachineStats
+	for _, s := range stats {
+		if s.CheatAttempts > 0 {
+			cheaters = append(cheaters, s)
+		}
+	}
+
+	if len(cheaters) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   "No cheaters caught yet.",
+		})
+		return
+	}
+
+	sort.Slice(cheaters, func(i, j int) bool {
+		return cheaters[i].CheatAttempts > cheaters[j].CheatAttempts
+	})
+
+	msg := "🚨 Caught cheating:"
+	for i, u := range cheaters {
+		name := u.Username
+		if name == "" {
+			name = fmt.Sprintf("User_%d", u.UserID)
+		}
+		msg += fmt.Sprintf("\n%d. %s - %d attempts", i+1, name, u.CheatAttempts)
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   msg,
+	})
+}
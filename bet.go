@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+// slotBetDivisor scales slot scores into wager multipliers: a spin scoring
+// 100 pays 100/slotBetDivisor times the bet. The default paytable averages
+// 180/64 points a spin, so bets return about 94% of the stake.
+const slotBetDivisor = 3
+
+const betUsage = "Usage: /bet <amount>, or /bet 0 to spin for points only"
+
+// betHandler shows or sets the sender's standing wager for slot spins
+func (c *casinoController) betHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	userID := update.Message.From.ID
+	username := update.Message.From.Username
+	groupID := update.Message.Chat.ID
+
+	if _, err := c.db.GetOrCreateStats(userID, groupID, username); err != nil {
+		log.Printf("error getting user: %v", err)
+		return
+	}
+	balance, err := c.db.GetOrCreateBalance(userID, groupID)
+	if err != nil {
+		log.Printf("error getting balance: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting balance.",
+		})
+		return
+	}
+
+	arg := strings.TrimSpace(strings.TrimPrefix(update.Message.Text, "/bet"))
+	if arg == "" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   betText(username, balance.Bet),
+		})
+		return
+	}
+
+	bet, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || bet < 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   betUsage,
+		})
+		return
+	}
+
+	if bet > balance.Amount {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   fmt.Sprintf("@%s, you only have %d$.", username, balance.Amount),
+		})
+		return
+	}
+
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		return c.db.SetBet(tx, userID, groupID, bet)
+	}); err != nil {
+		log.Printf("error setting bet: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error setting bet.",
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   betText(username, bet),
+	})
+}
+
+func betText(username string, bet int64) string {
+	if bet == 0 {
+		return fmt.Sprintf("@%s is spinning for free. Wins score points but pay nothing, set a bet with /bet <amount>.", username)
+	}
+	return fmt.Sprintf("@%s bets %d$ per spin. Wins pay points/%d times the bet, see /paytable.", username, bet, slotBetDivisor)
+}
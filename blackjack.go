@@ -0,0 +1,543 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+// maxBlackjackHands caps how many hands splitting can make
+const maxBlackjackHands = 4
+
+const blackjackUsage = "Usage: /blackjack <bet>. Admins: /blackjack soft17 <hit|stand>"
+
+// card is one of a deck's 52 cards: suit card/13, rank card%13 with 0 the ace
+type card int
+
+var (
+	cardRanks = []string{"A", "2", "3", "4", "5", "6", "7", "8", "9", "10", "J", "Q", "K"}
+	cardSuits = []string{"♠", "♥", "♦", "♣"}
+)
+
+func (c card) rank() int { return int(c) % 13 }
+
+// value counts aces as 1, handTotal decides when they count 11
+func (c card) value() int { return min(c.rank()+1, 10) }
+
+func (c card) String() string { return cardRanks[c.rank()] + cardSuits[int(c)/13] }
+
+// shuffledDeck is the deck a game deals from, fixed by its seed
+func shuffledDeck(seed int64) []card {
+	deck := make([]card, 52)
+	for i := range deck {
+		deck[i] = card(i)
+	}
+	seededRand(seed).Shuffle(len(deck), func(i, j int) { deck[i], deck[j] = deck[j], deck[i] })
+	return deck
+}
+
+// handTotal returns the best total of cards and whether an ace counts 11
+func handTotal(cards []card) (int, bool) {
+	total, aces := 0, false
+	for _, c := range cards {
+		total += c.value()
+		aces = aces || c.rank() == 0
+	}
+	if aces && total+10 <= 21 {
+		return total + 10, true
+	}
+	return total, false
+}
+
+func isBlackjack(cards []card) bool {
+	total, _ := handTotal(cards)
+	return len(cards) == 2 && total == 21
+}
+
+func cardsText(cards []card) string {
+	names := make([]string, len(cards))
+	for i, c := range cards {
+		names[i] = c.String()
+	}
+	return strings.Join(names, " ")
+}
+
+// blackjackHand is one of the player's hands; splitting makes more
+type blackjackHand struct {
+	Cards []card
+	Bet   int64
+	Done  bool
+}
+
+func (h *blackjackHand) canSplit(hands int) bool {
+	return len(h.Cards) == 2 && h.Cards[0].rank() == h.Cards[1].rank() && hands < maxBlackjackHands
+}
+
+// draw deals the next card of the game's deck
+func (g *BlackjackGame) draw() card {
+	c := shuffledDeck(g.Seed)[g.Drawn]
+	g.Drawn++
+	return c
+}
+
+// deal gives the player and the dealer two cards each
+func (g *BlackjackGame) deal(bet int64) {
+	hand := blackjackHand{Bet: bet}
+	hand.Cards = append(hand.Cards, g.draw())
+	g.Dealer = append(g.Dealer, g.draw())
+	hand.Cards = append(hand.Cards, g.draw())
+	g.Dealer = append(g.Dealer, g.draw())
+	g.Hands = []blackjackHand{hand}
+}
+
+// finished reports whether every hand has been played out
+func (g *BlackjackGame) finished() bool {
+	return g.Active >= len(g.Hands)
+}
+
+// advance moves past finished hands, dealing the second card of split hands
+// as they come up
+func (g *BlackjackGame) advance() {
+	for !g.finished() {
+		hand := &g.Hands[g.Active]
+		if len(hand.Cards) == 1 {
+			hand.Cards = append(hand.Cards, g.draw())
+			// Split aces get one card each
+			if hand.Cards[0].rank() == 0 {
+				hand.Done = true
+			}
+		}
+		if total, _ := handTotal(hand.Cards); total >= 21 {
+			hand.Done = true
+		}
+		if !hand.Done {
+			return
+		}
+		g.Active++
+	}
+}
+
+// playDealer draws the dealer's cards once the player is done, unless every
+// hand is already bust
+func (g *BlackjackGame) playDealer(hitSoft17 bool) {
+	for _, hand := range g.Hands {
+		if total, _ := handTotal(hand.Cards); total <= 21 {
+			for {
+				total, soft := handTotal(g.Dealer)
+				if total > 17 || (total == 17 && !(soft && hitSoft17)) {
+					return
+				}
+				g.Dealer = append(g.Dealer, g.draw())
+			}
+		}
+	}
+}
+
+// payout returns what a hand returns to the player, stake included, and how
+// it went. natural is set when the deal itself decided the game.
+func (g *BlackjackGame) payout(hand blackjackHand, natural bool) (int64, string) {
+	total, _ := handTotal(hand.Cards)
+	dealer, _ := handTotal(g.Dealer)
+	switch {
+	case natural && isBlackjack(hand.Cards) && isBlackjack(g.Dealer):
+		return hand.Bet, "push"
+	case natural && isBlackjack(hand.Cards):
+		return hand.Bet + hand.Bet*3/2, "blackjack"
+	case natural:
+		return 0, "dealer blackjack"
+	case total > 21:
+		return 0, "bust"
+	case dealer > 21 || total > dealer:
+		return 2 * hand.Bet, "win"
+	case total == dealer:
+		return hand.Bet, "push"
+	}
+	return 0, "lose"
+}
+
+// text renders the table. The dealer's hole card stays hidden until
+// the game is over.
+func (g *BlackjackGame) text(results []string) string {
+	msg := fmt.Sprintf("🃏 @%s's blackjack", g.Username)
+	if results == nil {
+		msg += fmt.Sprintf("\nDealer: %s ?", g.Dealer[0])
+	} else {
+		total, _ := handTotal(g.Dealer)
+		msg += fmt.Sprintf("\nDealer: %s (%d)", cardsText(g.Dealer), total)
+	}
+
+	for i, hand := range g.Hands {
+		label := "Hand"
+		if len(g.Hands) > 1 {
+			label = fmt.Sprintf("Hand %d", i+1)
+		}
+		total, _ := handTotal(hand.Cards)
+		msg += fmt.Sprintf("\n%s: %s (%d) · %d$", label, cardsText(hand.Cards), total, hand.Bet)
+		switch {
+		case results != nil:
+			msg += " - " + results[i]
+		case i == g.Active && len(g.Hands) > 1:
+			msg += " ◀"
+		}
+	}
+	return msg
+}
+
+func (g *BlackjackGame) keyboard() *models.InlineKeyboardMarkup {
+	hand := g.Hands[g.Active]
+	row := []models.InlineKeyboardButton{
+		{Text: "Hit", CallbackData: fmt.Sprintf("bj:hit:%d", g.ID)},
+		{Text: "Stand", CallbackData: fmt.Sprintf("bj:stand:%d", g.ID)},
+	}
+	if len(hand.Cards) == 2 {
+		row = append(row, models.InlineKeyboardButton{Text: "Double", CallbackData: fmt.Sprintf("bj:double:%d", g.ID)})
+	}
+	if hand.canSplit(len(g.Hands)) {
+		row = append(row, models.InlineKeyboardButton{Text: "Split", CallbackData: fmt.Sprintf("bj:split:%d", g.ID)})
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}
+}
+
+// settleBlackjack plays the dealer, pays every hand and removes the game. It
+// returns the final table.
+func (c *casinoController) settleBlackjack(tx *gorm.DB, g *BlackjackGame, natural bool) (string, error) {
+	settings, err := c.db.GetGroupSettings(g.GroupID)
+	if err != nil {
+		return "", err
+	}
+	if !natural {
+		g.playDealer(settings.BlackjackHitSoft17)
+	}
+
+	var total, staked int64
+	results := make([]string, len(g.Hands))
+	for i, hand := range g.Hands {
+		paid, result := g.payout(hand, natural)
+		total += paid
+		staked += hand.Bet
+		results[i] = result
+		if paid > 0 && paid != hand.Bet {
+			results[i] += fmt.Sprintf(", paid %d$", paid)
+		}
+	}
+
+	if err := c.db.UpdateBalance(tx, LedgerEntry{
+		UserID:    g.UserID,
+		GroupID:   g.GroupID,
+		Delta:     total,
+		Reason:    ledgerBlackjackWin,
+		MessageID: g.MessageID,
+		CreatedAt: c.clock.Now(),
+	}); err != nil {
+		return "", err
+	}
+	if g.ID != 0 {
+		if err := c.db.DeleteBlackjackGame(tx, g.ID); err != nil {
+			return "", err
+		}
+	}
+	return g.text(results) + fmt.Sprintf("\n@%s nets %+d$.\n%s", g.Username, total-staked, verifyText(g.FairRoundID)), nil
+}
+
+// blackjackHandler deals a new game, or lets admins set the dealer's rule
+func (c *casinoController) blackjackHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	userID := update.Message.From.ID
+	username := update.Message.From.Username
+	groupID := update.Message.Chat.ID
+
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/blackjack"))
+	if len(args) == 2 && args[0] == "soft17" {
+		c.setBlackjackSoft17(ctx, b, update, args[1])
+		return
+	}
+
+	var bet int64
+	if len(args) == 1 {
+		bet, _ = strconv.ParseInt(args[0], 10, 64)
+	}
+	if bet <= 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   blackjackUsage,
+		})
+		return
+	}
+
+	if _, err := c.db.GetOrCreateStats(userID, groupID, username); err != nil {
+		log.Printf("error getting user: %v", err)
+		return
+	}
+	if _, err := c.db.GetOrCreateBalance(userID, groupID); err != nil {
+		log.Printf("error getting balance: %v", err)
+		return
+	}
+
+	game := &BlackjackGame{
+		GroupID:   groupID,
+		UserID:    userID,
+		Username:  username,
+		MessageID: update.Message.ID,
+	}
+	var reply string
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := c.db.GetActiveBlackjackGame(tx, groupID, userID); err != gorm.ErrRecordNotFound {
+			if err == nil {
+				reply = fmt.Sprintf("@%s, finish your current hand first.", username)
+			}
+			return err
+		}
+
+		balance, err := c.db.GetBalance(tx, userID, groupID)
+		if err != nil {
+			return err
+		}
+		if balance.Amount < bet {
+			reply = fmt.Sprintf("@%s, you only have %d$.", username, balance.Amount)
+			return nil
+		}
+
+		if err := c.db.UpdateBalance(tx, LedgerEntry{
+			UserID:    userID,
+			GroupID:   groupID,
+			Delta:     -bet,
+			Reason:    ledgerBlackjackBet,
+			MessageID: update.Message.ID,
+			CreatedAt: c.clock.Now(),
+		}); err != nil {
+			return err
+		}
+
+		fair, seed, err := c.fairDraw(tx, groupID, "blackjack", 0)
+		if err != nil {
+			return err
+		}
+		game.FairRoundID = fair.ID
+		game.Seed = seed
+		game.deal(bet)
+		if isBlackjack(game.Hands[0].Cards) || isBlackjack(game.Dealer) {
+			reply, err = c.settleBlackjack(tx, game, true)
+			return err
+		}
+		return c.db.CreateBlackjackGame(tx, game)
+	})
+	if err != nil {
+		log.Printf("error dealing blackjack: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error dealing blackjack.",
+		})
+		return
+	}
+
+	if reply != "" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          groupID,
+			Text:            reply,
+			ReplyParameters: replyParameters(update.Message.ID),
+		})
+		return
+	}
+
+	msg, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          groupID,
+		Text:            game.text(nil),
+		ReplyMarkup:     game.keyboard(),
+		ReplyParameters: replyParameters(update.Message.ID),
+	})
+	if err != nil {
+		log.Printf("error sending blackjack table: %v", err)
+		return
+	}
+	if err := c.db.SetBlackjackMessageID(c.db.DB, game.ID, msg.ID); err != nil {
+		log.Printf("error saving blackjack message: %v", err)
+	}
+}
+
+// blackjackCallbackHandler plays the hit, stand, double and split buttons
+func (c *casinoController) blackjackCallbackHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	query := update.CallbackQuery
+	if query == nil {
+		return
+	}
+
+	answer := func(text string) {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            text,
+			ShowAlert:       text != "",
+		}); err != nil {
+			log.Printf("error answering callback query: %v", err)
+		}
+	}
+
+	parts := strings.Split(query.Data, ":")
+	if len(parts) != 3 {
+		answer("")
+		return
+	}
+	action := parts[1]
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		answer("")
+		return
+	}
+
+	var game *BlackjackGame
+	var alert, text string
+	finished := false
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		game, err = c.db.GetBlackjackGame(tx, uint(id))
+		if err == gorm.ErrRecordNotFound {
+			alert = "This hand is over."
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if query.From.ID != game.UserID {
+			alert = fmt.Sprintf("This is @%s's hand!", game.Username)
+			return nil
+		}
+
+		alert, err = c.playBlackjack(tx, game, action)
+		if err != nil || alert != "" {
+			return err
+		}
+
+		if game.finished() {
+			finished = true
+			text, err = c.settleBlackjack(tx, game, false)
+			return err
+		}
+		text = game.text(nil)
+		return c.db.SaveBlackjackGame(tx, game)
+	})
+	if err != nil {
+		// The move was rolled back, so the table keeps its last saved state
+		log.Printf("error playing blackjack: %v", err)
+		alert, text = "Error playing blackjack.", ""
+	}
+	answer(alert)
+	if text == "" {
+		return
+	}
+
+	params := &bot.EditMessageTextParams{
+		ChatID:    game.GroupID,
+		MessageID: game.MessageID,
+		Text:      text,
+	}
+	if !finished {
+		params.ReplyMarkup = game.keyboard()
+	}
+	if _, err := b.EditMessageText(ctx, params); err != nil {
+		log.Printf("error editing blackjack table: %v", err)
+	}
+}
+
+// playBlackjack applies a button press to the active hand. It returns an
+// alert when the move isn't allowed.
+func (c *casinoController) playBlackjack(tx *gorm.DB, g *BlackjackGame, action string) (string, error) {
+	hand := &g.Hands[g.Active]
+
+	switch action {
+	case "hit":
+		hand.Cards = append(hand.Cards, g.draw())
+	case "stand":
+		hand.Done = true
+	case "double", "split":
+		if len(hand.Cards) != 2 || (action == "split" && !hand.canSplit(len(g.Hands))) {
+			return "You can't do that now.", nil
+		}
+		balance, err := c.db.GetBalance(tx, g.UserID, g.GroupID)
+		if err != nil {
+			return "", err
+		}
+		if balance.Amount < hand.Bet {
+			return fmt.Sprintf("You can't cover another %d$.", hand.Bet), nil
+		}
+		if err := c.db.UpdateBalance(tx, LedgerEntry{
+			UserID:    g.UserID,
+			GroupID:   g.GroupID,
+			Delta:     -hand.Bet,
+			Reason:    ledgerBlackjackBet,
+			MessageID: g.MessageID,
+			CreatedAt: c.clock.Now(),
+		}); err != nil {
+			return "", err
+		}
+
+		if action == "double" {
+			hand.Bet *= 2
+			hand.Cards = append(hand.Cards, g.draw())
+			hand.Done = true
+		} else {
+			split := blackjackHand{Cards: []card{hand.Cards[1]}, Bet: hand.Bet}
+			hand.Cards = hand.Cards[:1]
+			g.Hands = append(g.Hands[:g.Active+1], append([]blackjackHand{split}, g.Hands[g.Active+1:]...)...)
+		}
+	default:
+		return "", nil
+	}
+
+	g.advance()
+	return "", nil
+}
+
+// setBlackjackSoft17 handles /blackjack soft17 <hit|stand>
+func (c *casinoController) setBlackjackSoft17(ctx context.Context, b BotInterface, update *models.Update, rule string) {
+	groupID := update.Message.Chat.ID
+
+	if !c.requireAdmin(ctx, b, update) {
+		return
+	}
+
+	if rule != "hit" && rule != "stand" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   blackjackUsage,
+		})
+		return
+	}
+
+	settings, err := c.db.GetGroupSettings(groupID)
+	if err != nil {
+		log.Printf("error getting group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting settings.",
+		})
+		return
+	}
+	settings.BlackjackHitSoft17 = rule == "hit"
+
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		if err := c.db.SaveGroupSettings(tx, settings); err != nil {
+			return err
+		}
+		return c.auditAdminAction(tx, update, "blackjack", 0, "soft17 "+rule)
+	}); err != nil {
+		log.Printf("error saving group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error saving settings.",
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   fmt.Sprintf("The dealer now %ss on soft 17.", rule),
+	})
+}
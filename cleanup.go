@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+const cleanupUsage = "Usage: /cleanup <losers|winners> <delay|never>, e.g. /cleanup losers 1m or /cleanup winners never"
+
+// cleanupHandler shows or changes how long spin messages stay in the chat
+func (c *casinoController) cleanupHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+
+	settings, err := c.db.GetGroupSettings(groupID)
+	if err != nil {
+		log.Printf("error getting group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting settings.",
+		})
+		return
+	}
+
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/cleanup"))
+	if len(args) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text: fmt.Sprintf("Losing spins: %s\nWinning spins: %s",
+				cleanupText(settings.LosingSpinCleanup), cleanupText(settings.WinningSpinCleanup)),
+		})
+		return
+	}
+
+	if !c.requireAdmin(ctx, b, update) {
+		return
+	}
+
+	delay, ok := parseCleanupDelay(args)
+	if !ok {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   cleanupUsage,
+		})
+		return
+	}
+
+	var target *time.Duration
+	var label string
+	switch args[0] {
+	case "losers":
+		target, label = &settings.LosingSpinCleanup, "Losing"
+	case "winners":
+		target, label = &settings.WinningSpinCleanup, "Winning"
+	default:
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   cleanupUsage,
+		})
+		return
+	}
+	*target = delay
+
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		if err := c.db.SaveGroupSettings(tx, settings); err != nil {
+			return err
+		}
+		return c.auditAdminAction(tx, update, "cleanup", 0, strings.Join(args, " "))
+	}); err != nil {
+		log.Printf("error saving group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error saving settings.",
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   fmt.Sprintf("%s spins: %s", label, cleanupText(delay)),
+	})
+}
+
+// parseCleanupDelay parses "<losers|winners> <delay|never>" into the delay,
+// using a negative delay for never
+func parseCleanupDelay(args []string) (time.Duration, bool) {
+	if len(args) != 2 {
+		return 0, false
+	}
+	if args[1] == "never" {
+		return -1, true
+	}
+	delay, err := time.ParseDuration(args[1])
+	if err != nil || delay < 0 {
+		return 0, false
+	}
+	return delay, true
+}
+
+func cleanupText(delay time.Duration) string {
+	if delay < 0 {
+		return "never deleted"
+	}
+	return "deleted after " + formatDuration(delay)
+}
+
+// formatDuration prints d without trailing zero units, e.g. "1m" not "1m0s"
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// scheduleSpinCleanup queues a spin message for deletion according to the
+// group's settings
+func (c *casinoController) scheduleSpinCleanup(groupID int64, messageID int, won bool) {
+	settings, err := c.db.GetGroupSettings(groupID)
+	if err != nil {
+		log.Printf("error getting group settings: %v", err)
+		return
+	}
+
+	delay := settings.LosingSpinCleanup
+	if won {
+		delay = settings.WinningSpinCleanup
+	}
+	if delay < 0 {
+		return
+	}
+
+	if err := c.db.ScheduleDeletion(c.db.DB, &ScheduledDeletion{
+		ChatID:    groupID,
+		MessageID: messageID,
+		DeleteAt:  c.clock.Now().Add(delay),
+	}); err != nil {
+		log.Printf("error scheduling deletion: %v", err)
+	}
+}
+
+// deleteDueMessages deletes queued messages whose time has come, including
+// any left over from before a restart. Each deletion is attempted once.
+func (c *casinoController) deleteDueMessages(ctx context.Context, b BotInterface) {
+	due, err := c.db.GetDueDeletions(c.clock.Now())
+	if err != nil {
+		log.Printf("error getting scheduled deletions: %v", err)
+		return
+	}
+
+	for _, d := range due {
+		lock := c.groupLock(d.ChatID)
+		lock.Lock()
+		claimed, err := c.db.ClaimScheduledDeletion(d.ID)
+		lock.Unlock()
+		if err != nil {
+			log.Printf("error deleting scheduled deletion: %v", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		if _, err := b.DeleteMessage(ctx, &bot.DeleteMessageParams{
+			ChatID:    d.ChatID,
+			MessageID: d.MessageID,
+		}); err != nil {
+			log.Printf("error deleting message: %v", err)
+		}
+	}
+}
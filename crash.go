@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// crashBettingWindow is how long players can join before launch
+	crashBettingWindow = 15 * time.Second
+	// crashEditInterval keeps live multiplier edits under Telegram's limits
+	crashEditInterval = 2 * time.Second
+	// crashGrowth is the multiplier's growth rate per second: 2x after
+	// about 11.5s, 10x after about 38s
+	crashGrowth = 0.06
+	// crashChainLength is how many rounds one hash chain covers
+	crashChainLength = 1000
+)
+
+const crashUsage = "Usage: /crash <bet> to join the next round, or /crash to see the hash chain and recent rounds"
+
+// crashHash returns the hash following h in a chain
+func crashHash(h string) string {
+	sum := sha256.Sum256([]byte(h))
+	return hex.EncodeToString(sum[:])
+}
+
+// crashChainHash returns the hash for round n of a chain, the seed hashed
+// crashChainLength-n times. Round n's hash hashes to round n-1's, and round
+// 0's is the chain's published anchor.
+func crashChainHash(seed string, n int) string {
+	h := seed
+	for i := 0; i < crashChainLength-n; i++ {
+		h = crashHash(h)
+	}
+	return h
+}
+
+// crashPoint turns a round's hash into where it crashes, in hundredths. One
+// round in 33 crashes instantly; otherwise the odds of reaching x are about
+// 1/x.
+func crashPoint(hash string) int64 {
+	b, err := hex.DecodeString(hash)
+	if err != nil || len(b) < 8 {
+		return 100
+	}
+	h := binary.BigEndian.Uint64(b[:8]) >> 12
+	if h%33 == 0 {
+		return 100
+	}
+	const e = uint64(1) << 52
+	return int64((100*e - h) / (e - h))
+}
+
+// crashMultiplier is the multiplier, in hundredths, elapsed into the flight
+func crashMultiplier(elapsed time.Duration) int64 {
+	return int64(100 * math.Exp(crashGrowth*elapsed.Seconds()))
+}
+
+// crashAt is when a round's multiplier reaches its crash point
+func (r *CrashRound) crashAt() time.Time {
+	return r.StartsAt.Add(time.Duration(math.Log(float64(r.CrashPoint)/100) / crashGrowth * float64(time.Second)))
+}
+
+func crashBetsText(bets []CrashBet, crashed bool) string {
+	var text string
+	for _, bet := range bets {
+		text += fmt.Sprintf("\n@%s %d$", bet.Username, bet.Amount)
+		switch {
+		case bet.CashedOut > 0:
+			text += fmt.Sprintf(" - cashed out at %s for %d$", hiloMultiplierText(bet.CashedOut), bet.Amount*bet.CashedOut/100)
+		case crashed:
+			text += " - lost"
+		}
+	}
+	return text
+}
+
+func crashKeyboard(round *CrashRound) *models.InlineKeyboardMarkup {
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{
+		{Text: "Cash out", CallbackData: fmt.Sprintf("crash:cashout:%d", round.ID)},
+	}}}
+}
+
+// crashHandler joins the group's next crash round, opening it if needed, or
+// shows the hash chain
+func (c *casinoController) crashHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	userID := update.Message.From.ID
+	username := update.Message.From.Username
+	groupID := update.Message.Chat.ID
+
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/crash"))
+	if len(args) == 0 {
+		c.showCrashChain(ctx, b, groupID)
+		return
+	}
+
+	var bet int64
+	if len(args) == 1 {
+		bet, _ = strconv.ParseInt(args[0], 10, 64)
+	}
+	if bet <= 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   crashUsage,
+		})
+		return
+	}
+
+	if _, err := c.db.GetOrCreateStats(userID, groupID, username); err != nil {
+		log.Printf("error getting user: %v", err)
+		return
+	}
+	if _, err := c.db.GetOrCreateBalance(userID, groupID); err != nil {
+		log.Printf("error getting balance: %v", err)
+		return
+	}
+
+	var round *CrashRound
+	var bets []CrashBet
+	var reply string
+	opened := false
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		balance, err := c.db.GetBalance(tx, userID, groupID)
+		if err != nil {
+			return err
+		}
+		if balance.Amount < bet {
+			reply = fmt.Sprintf("@%s, you only have %d$.", username, balance.Amount)
+			return nil
+		}
+
+		round, err = c.db.GetActiveCrashRound(tx, groupID)
+		if err == gorm.ErrRecordNotFound {
+			opened = true
+			round, err = c.openCrashRound(tx, groupID)
+		}
+		if err != nil {
+			return err
+		}
+		if !c.clock.Now().Before(round.StartsAt) {
+			reply = "This round has launched. Join the next one once it crashes."
+			return nil
+		}
+
+		bets, err = c.db.GetCrashBets(tx, round.ID)
+		if err != nil {
+			return err
+		}
+		for _, other := range bets {
+			if other.UserID == userID {
+				reply = fmt.Sprintf("@%s, you're already in this round.", username)
+				return nil
+			}
+		}
+
+		if err := c.db.UpdateBalance(tx, LedgerEntry{
+			UserID:    userID,
+			GroupID:   groupID,
+			Delta:     -bet,
+			Reason:    ledgerCrashBet,
+			MessageID: update.Message.ID,
+			CreatedAt: c.clock.Now(),
+		}); err != nil {
+			return err
+		}
+		crashBet := CrashBet{
+			RoundID:  round.ID,
+			GroupID:  groupID,
+			UserID:   userID,
+			Username: username,
+			Amount:   bet,
+		}
+		bets = append(bets, crashBet)
+		return c.db.CreateCrashBet(tx, &crashBet)
+	})
+	if err != nil {
+		log.Printf("error joining crash: %v", err)
+		reply = "Error joining crash."
+	}
+	if reply != "" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          groupID,
+			Text:            reply,
+			ReplyParameters: replyParameters(update.Message.ID),
+		})
+		return
+	}
+
+	text := fmt.Sprintf("🚀 Crash round #%d launches in %s. Join with /crash <bet>.%s",
+		round.ID, formatDuration(round.StartsAt.Sub(c.clock.Now())), crashBetsText(bets, false))
+	if !opened {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          groupID,
+			Text:            fmt.Sprintf("@%s joins crash round #%d with %d$.", username, round.ID, bet),
+			ReplyParameters: replyParameters(update.Message.ID),
+		})
+		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:    groupID,
+			MessageID: round.MessageID,
+			Text:      text,
+		}); err != nil {
+			log.Printf("error editing crash round: %v", err)
+		}
+		return
+	}
+
+	msg, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   text,
+	})
+	if err != nil {
+		log.Printf("error sending crash round: %v", err)
+		return
+	}
+	if err := c.db.SetCrashMessageID(c.db.DB, round.ID, msg.ID); err != nil {
+		log.Printf("error saving crash message: %v", err)
+	}
+}
+
+// openCrashRound creates the group's next round from its hash chain,
+// starting a new chain once the current one is used up
+func (c *casinoController) openCrashRound(tx *gorm.DB, groupID int64) (*CrashRound, error) {
+	chain, err := c.db.GetCrashChain(tx, groupID)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	if err == gorm.ErrRecordNotFound || chain.Used >= crashChainLength {
+		seed := c.newSecret()
+		chain = &CrashChain{
+			GroupID: groupID,
+			Seed:    seed,
+			Anchor:  crashChainHash(seed, 0),
+		}
+	}
+	chain.Used++
+	if err := c.db.SaveCrashChain(tx, chain); err != nil {
+		return nil, err
+	}
+
+	hash := crashChainHash(chain.Seed, chain.Used)
+	round := &CrashRound{
+		GroupID:    groupID,
+		Anchor:     chain.Anchor,
+		Number:     chain.Used,
+		Hash:       hash,
+		CrashPoint: crashPoint(hash),
+		StartsAt:   c.clock.Now().Add(crashBettingWindow),
+	}
+	return round, c.db.CreateCrashRound(tx, round)
+}
+
+// showCrashChain posts the group's chain anchor and its recent crash points
+// with the hashes they came from
+func (c *casinoController) showCrashChain(ctx context.Context, b BotInterface, groupID int64) {
+	chain, err := c.db.GetCrashChain(c.db.DB, groupID)
+	var rounds []CrashRound
+	if err == nil {
+		rounds, err = c.db.GetCrashedRounds(groupID, 5)
+	}
+	if err == gorm.ErrRecordNotFound {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "No crash rounds yet. Start one with /crash <bet>.",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error getting crash chain: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting crash chain.",
+		})
+		return
+	}
+
+	text := fmt.Sprintf("🚀 Crash chain anchor: %s", chain.Anchor)
+	for _, r := range rounds {
+		text += fmt.Sprintf("\n#%d %s %s", r.ID, hiloMultiplierText(r.CrashPoint), r.Hash)
+	}
+	text += "\nEach round's hash is the SHA-256 of the next round's, and the chain's first round hashes to the anchor, so no crash point can be changed once the anchor is out."
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   text,
+	})
+}
+
+// crashCallbackHandler cashes a player out of a round in flight
+func (c *casinoController) crashCallbackHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	query := update.CallbackQuery
+	if query == nil {
+		return
+	}
+
+	answer := func(text string) {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            text,
+			ShowAlert:       text != "",
+		}); err != nil {
+			log.Printf("error answering callback query: %v", err)
+		}
+	}
+
+	parts := strings.Split(query.Data, ":")
+	if len(parts) != 3 || parts[1] != "cashout" {
+		answer("")
+		return
+	}
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		answer("")
+		return
+	}
+
+	var round *CrashRound
+	var bets []CrashBet
+	var alert string
+	var multiplier int64
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		round, err = c.db.GetCrashRound(tx, uint(id))
+		if err != nil {
+			return err
+		}
+		now := c.clock.Now()
+		switch {
+		case now.Before(round.StartsAt):
+			alert = "The round hasn't launched yet."
+			return nil
+		case round.Crashed || !now.Before(round.crashAt()):
+			alert = "Too late, it crashed!"
+			return nil
+		}
+
+		bets, err = c.db.GetCrashBets(tx, round.ID)
+		if err != nil {
+			return err
+		}
+		for i := range bets {
+			bet := &bets[i]
+			if bet.UserID != query.From.ID {
+				continue
+			}
+			if bet.CashedOut > 0 {
+				alert = "You already cashed out."
+				return nil
+			}
+
+			multiplier = crashMultiplier(now.Sub(round.StartsAt))
+			bet.CashedOut = multiplier
+			if err := c.db.UpdateBalance(tx, LedgerEntry{
+				UserID:    bet.UserID,
+				GroupID:   bet.GroupID,
+				Delta:     bet.Amount * multiplier / 100,
+				Reason:    ledgerCrashWin,
+				MessageID: round.MessageID,
+				CreatedAt: now,
+			}); err != nil {
+				return err
+			}
+			alert = fmt.Sprintf("Cashed out at %s for %d$!", hiloMultiplierText(multiplier), bet.Amount*multiplier/100)
+			return c.db.SaveCrashBet(tx, bet)
+		}
+		alert = "You're not in this round."
+		return nil
+	})
+	if err == gorm.ErrRecordNotFound {
+		alert, err = "This round is over.", nil
+	}
+	if err != nil {
+		log.Printf("error cashing out of crash: %v", err)
+		alert = "Error cashing out."
+	}
+	answer(alert)
+	if multiplier == 0 {
+		return
+	}
+
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      round.GroupID,
+		MessageID:   round.MessageID,
+		Text:        fmt.Sprintf("🚀 Crash round #%d: %s%s", round.ID, hiloMultiplierText(multiplier), crashBetsText(bets, false)),
+		ReplyMarkup: crashKeyboard(round),
+	}); err != nil {
+		log.Printf("error editing crash round: %v", err)
+	}
+}
+
+// tickCrashRounds moves launched rounds along: it edits their live
+// multiplier and, once the crash point is reached, ends them and reveals
+// their hash.
+func (c *casinoController) tickCrashRounds(ctx context.Context, b BotInterface) {
+	rounds, err := c.db.GetLaunchedCrashRounds(c.clock.Now())
+	if err != nil {
+		log.Printf("error getting crash rounds: %v", err)
+		return
+	}
+
+	for _, round := range rounds {
+		// Cash outs come in through handlers holding the group's lock
+		lock := c.groupLock(round.GroupID)
+		lock.Lock()
+		params, err := c.tickCrashRound(&round)
+		lock.Unlock()
+		if err != nil {
+			log.Printf("error ticking crash round: %v", err)
+			continue
+		}
+		if params == nil {
+			continue
+		}
+
+		if _, err := b.EditMessageText(ctx, params); err != nil {
+			log.Printf("error editing crash round: %v", err)
+		}
+	}
+}
+
+// tickCrashRound returns the edit a round's message needs, if any
+func (c *casinoController) tickCrashRound(round *CrashRound) (*bot.EditMessageTextParams, error) {
+	now := c.clock.Now()
+	if !round.Crashed && now.Before(round.crashAt()) && now.Sub(round.LastEditAt) < crashEditInterval {
+		return nil, nil
+	}
+
+	var params *bot.EditMessageTextParams
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		bets, err := c.db.GetCrashBets(tx, round.ID)
+		if err != nil {
+			return err
+		}
+
+		round.LastEditAt = now
+		params = &bot.EditMessageTextParams{
+			ChatID:    round.GroupID,
+			MessageID: round.MessageID,
+		}
+		if now.Before(round.crashAt()) {
+			params.Text = fmt.Sprintf("🚀 Crash round #%d: %s%s",
+				round.ID, hiloMultiplierText(crashMultiplier(now.Sub(round.StartsAt))), crashBetsText(bets, false))
+			params.ReplyMarkup = crashKeyboard(round)
+		} else {
+			round.Crashed = true
+			params.Text = fmt.Sprintf("💥 Crash round #%d crashed at %s!%s\nHash: %s",
+				round.ID, hiloMultiplierText(round.CrashPoint), crashBetsText(bets, true), round.Hash)
+		}
+		return c.db.SaveCrashRound(tx, round)
+	})
+	return params, err
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// dailyCooldown is how long a player waits between /daily claims
+	dailyCooldown = 24 * time.Hour
+	// dailyStreakWindow is how long after the last claim a new one still
+	// continues the streak
+	dailyStreakWindow = 48 * time.Hour
+	// Each day of a streak adds 10% to the allowance, up to this many days
+	maxDailyStreakBonus = 10
+)
+
+const dailyUsage = "Usage: /daily to claim, or /daily set <amount> to change the allowance"
+
+// dailyAmount is the allowance paid on day streak of a streak
+func dailyAmount(allowance, streak int64) int64 {
+	return allowance * (10 + min(streak-1, maxDailyStreakBonus)) / 10
+}
+
+// dailyHandler pays the daily allowance, or lets admins change it
+func (c *casinoController) dailyHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	userID := update.Message.From.ID
+	username := update.Message.From.Username
+	groupID := update.Message.Chat.ID
+
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/daily"))
+	if len(args) > 0 {
+		c.setDailyAllowance(ctx, b, update, args)
+		return
+	}
+
+	settings, err := c.db.GetGroupSettings(groupID)
+	if err != nil {
+		log.Printf("error getting group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting settings.",
+		})
+		return
+	}
+
+	if _, err := c.db.GetOrCreateStats(userID, groupID, username); err != nil {
+		log.Printf("error getting user: %v", err)
+		return
+	}
+	if _, err := c.db.GetOrCreateBalance(userID, groupID); err != nil {
+		log.Printf("error getting balance: %v", err)
+		return
+	}
+
+	now := c.clock.Now()
+	var reply string
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		claim, err := c.db.GetDailyClaim(tx, userID, groupID)
+		if err != nil {
+			return err
+		}
+
+		since := now.Sub(claim.LastClaimAt)
+		if since < dailyCooldown {
+			reply = fmt.Sprintf("@%s, you already claimed today. Come back in %s.",
+				username, formatDuration((dailyCooldown - since).Truncate(time.Minute)))
+			return nil
+		}
+
+		brokenStreak := int64(0)
+		if claim.Streak > 0 && since >= dailyStreakWindow {
+			brokenStreak = claim.Streak
+			claim.Streak = 0
+		}
+		claim.Streak++
+		claim.LastClaimAt = now
+
+		amount := dailyAmount(settings.DailyAllowance, claim.Streak)
+		if err := c.db.SaveDailyClaim(tx, claim); err != nil {
+			return err
+		}
+		if err := c.db.UpdateBalance(tx, LedgerEntry{
+			UserID:    userID,
+			GroupID:   groupID,
+			Delta:     amount,
+			Reason:    ledgerDaily,
+			MessageID: update.Message.ID,
+			CreatedAt: now,
+		}); err != nil {
+			return err
+		}
+
+		reply = fmt.Sprintf("🎁 @%s claims %d$ (day %d streak).", username, amount, claim.Streak)
+		if brokenStreak > 1 {
+			reply = fmt.Sprintf("💔 @%s, your %d-day streak is broken.\n", username, brokenStreak) + reply
+		}
+		if claim.Streak <= maxDailyStreakBonus {
+			reply += fmt.Sprintf(" Come back tomorrow for %d$.", dailyAmount(settings.DailyAllowance, claim.Streak+1))
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("error claiming daily: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error claiming daily bonus.",
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          groupID,
+		Text:            reply,
+		ReplyParameters: replyParameters(update.Message.ID),
+	})
+}
+
+// setDailyAllowance handles /daily set <amount>
+func (c *casinoController) setDailyAllowance(ctx context.Context, b BotInterface, update *models.Update, args []string) {
+	groupID := update.Message.Chat.ID
+
+	if !c.requireAdmin(ctx, b, update) {
+		return
+	}
+
+	if len(args) != 2 || args[0] != "set" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   dailyUsage,
+		})
+		return
+	}
+	allowance, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || allowance < 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   dailyUsage,
+		})
+		return
+	}
+
+	settings, err := c.db.GetGroupSettings(groupID)
+	if err != nil {
+		log.Printf("error getting group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting settings.",
+		})
+		return
+	}
+	settings.DailyAllowance = allowance
+
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		if err := c.db.SaveGroupSettings(tx, settings); err != nil {
+			return err
+		}
+		return c.auditAdminAction(tx, update, "daily", 0, strings.Join(args, " "))
+	}); err != nil {
+		log.Printf("error saving group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error saving settings.",
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   fmt.Sprintf("/daily now pays %d$, plus 10%% per streak day up to %d days.", allowance, maxDailyStreakBonus),
+	})
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type DB struct {
@@ -13,8 +16,8 @@ type DB struct {
 }
 
 type SlotMachineStats struct {
-	UserID       int64     `gorm:"primaryKey"`
-	GroupID      int64     `gorm:"primaryKey"`
+	UserID       int64 `gorm:"primaryKey"`
+	GroupID      int64 `gorm:"primaryKey"`
 	Username     string
 	BarWins      int64
 	CherryWins   int64
@@ -23,35 +26,480 @@ type SlotMachineStats struct {
 	TotalGames   int64
 	Score        int64
 	LastPlayedAt time.Time
+
+	// Forwarded, bot-sent or edited dice rejected by the anti-cheat
+	CheatAttempts int64
+}
+
+// DiceGameStats tracks a player's results in one of diceGames
+type DiceGameStats struct {
+	UserID       int64  `gorm:"primaryKey"`
+	GroupID      int64  `gorm:"primaryKey"`
+	Emoji        string `gorm:"primaryKey"`
+	Username     string
+	TotalGames   int64
+	Wins         int64 // rolls that scored any points
+	TopHits      int64 // rolls with the game's best result
+	Score        int64
+	LastPlayedAt time.Time
 }
 
 type Balance struct {
 	UserID  int64 `gorm:"primaryKey"`
 	GroupID int64 `gorm:"primaryKey"`
 	Amount  int64
+	Bet     int64 // standing wager per slot spin, 0 for free spins that pay nothing
 }
 
 type PendingDuel struct {
+	ID            uint  `gorm:"primaryKey"`
+	GroupID       int64 `gorm:"index"`
 	InitiatorID   int64
 	TargetID      int64
-	GroupID       int64
 	TargetName    string
 	InitiatorName string
+	Stake         int64 // ignored when AllIn is set
+	AllIn         bool
+	MessageID     int // challenge message carrying the inline buttons
 	ExpiresAt     time.Time
+
+	// Set once the target accepts and both stakes are held in escrow
+	Accepted        bool
+	InitiatorEscrow int64
+	TargetEscrow    int64
+}
+
+// BlackjackGame is a game of blackjack waiting on the player. Bets leave the
+// balance when placed and stay with the game until it settles, so a restart
+// picks the hand up where it was.
+type BlackjackGame struct {
+	ID          uint  `gorm:"primaryKey"`
+	GroupID     int64 `gorm:"index"`
+	UserID      int64
+	Username    string
+	MessageID   int             // table message carrying the inline buttons
+	FairRoundID uint            // the draw Seed came from
+	Seed        int64           // shuffles the deck, see shuffledDeck
+	Drawn       int             // cards dealt from the deck so far
+	Dealer      []card          `gorm:"serializer:json"`
+	Hands       []blackjackHand `gorm:"serializer:json"`
+	Active      int             // index of the hand being played
+}
+
+// RouletteRound is a roulette round taking bets until ClosesAt, when the
+// scheduler spins the wheel
+type RouletteRound struct {
+	ID       uint  `gorm:"primaryKey"`
+	GroupID  int64 `gorm:"index"`
+	ClosesAt time.Time
+}
+
+// RouletteBet is a stake on a roulette round, held off the player's balance
+// until the round is spun
+type RouletteBet struct {
+	ID       uint `gorm:"primaryKey"`
+	RoundID  uint `gorm:"index"`
+	GroupID  int64
+	UserID   int64
+	Username string
+	Kind     string // rouletteNumber, rouletteRed, ...
+	Number   int    // the number, or the dozen for dozen bets
+	Amount   int64
+}
+
+// LotteryRound is a group's lottery. The open round collects ticket money
+// in Pot until DrawAt; drawn rounds stay as a record of who won.
+type LotteryRound struct {
+	ID      uint  `gorm:"primaryKey"`
+	GroupID int64 `gorm:"index"`
+	Pot     int64
+	DrawAt  time.Time
+	Drawn   bool
+
+	// Set once drawn
+	WinnerID   int64
+	WinnerName string
+	Payout     int64
+}
+
+// LotteryTicket is how many tickets a player holds in a lottery round
+type LotteryTicket struct {
+	RoundID  uint  `gorm:"primaryKey"`
+	UserID   int64 `gorm:"primaryKey"`
+	GroupID  int64
+	Username string
+	Count    int64
+}
+
+// HiloGame is a game of higher or lower in progress. The bet leaves the
+// balance when the game starts; Cards are dealt in order from the deck
+// shuffled by Seed.
+type HiloGame struct {
+	ID          uint  `gorm:"primaryKey"`
+	GroupID     int64 `gorm:"index"`
+	UserID      int64
+	Username    string
+	MessageID   int // game message carrying the inline buttons
+	FairRoundID uint
+	Seed        int64
+	Bet         int64
+	Multiplier  int64  // in hundredths, 100 until the first right guess
+	Cards       []card `gorm:"serializer:json"`
+}
+
+// QuickGameStats tracks a player's results in a single-player wager game
+// such as /flip or /hilo
+type QuickGameStats struct {
+	UserID       int64  `gorm:"primaryKey"`
+	GroupID      int64  `gorm:"primaryKey"`
+	Game         string `gorm:"primaryKey"` // key of quickGames
+	Username     string
+	Played       int64
+	Won          int64 // games that returned more than the stake
+	Wagered      int64
+	Returned     int64 // paid back to the player, stakes included
+	LastPlayedAt time.Time
+}
+
+// CrashChain is a group's provably fair hash chain for crash rounds, see
+// crashChainHash. Seed stays secret; Anchor is published before any round
+// uses the chain.
+type CrashChain struct {
+	GroupID int64 `gorm:"primaryKey"`
+	Seed    string
+	Anchor  string
+	Used    int // rounds taken from the chain so far
+}
+
+// CrashRound is a crash round. Players join until StartsAt, then the
+// multiplier climbs until it reaches CrashPoint. Crashed rounds are kept so
+// their hashes can be checked against the chain.
+type CrashRound struct {
+	ID         uint  `gorm:"primaryKey"`
+	GroupID    int64 `gorm:"index"`
+	MessageID  int   // live message carrying the cash out button
+	Anchor     string
+	Number     int    // position in the chain
+	Hash       string // revealed once the round crashes
+	CrashPoint int64  // in hundredths
+	StartsAt   time.Time
+	LastEditAt time.Time
+	Crashed    bool
+}
+
+// CrashBet is a player's stake in a crash round, CashedOut the multiplier in
+// hundredths they left at, 0 if they rode it down
+type CrashBet struct {
+	ID        uint `gorm:"primaryKey"`
+	RoundID   uint `gorm:"index"`
+	GroupID   int64
+	UserID    int64
+	Username  string
+	Amount    int64
+	CashedOut int64
+}
+
+// ServerSeed is a secret seed behind a group's game results. Its Hash is
+// published while it is Active and the seed itself only once it is retired,
+// see fairDraw.
+type ServerSeed struct {
+	ID         uint  `gorm:"primaryKey"`
+	GroupID    int64 `gorm:"index"`
+	Seed       string
+	Hash       string
+	ClientSeed string
+	Nonce      int64 // nonce of the next round drawn from the seed
+	Active     bool
+}
+
+// FairRound records what a game result was drawn from so /verify can
+// recompute it
+type FairRound struct {
+	ID           uint   `gorm:"primaryKey"`
+	GroupID      int64  `gorm:"index"`
+	Game         string // key of fairResults
+	ServerSeedID uint
+	ClientSeed   string
+	Nonce        int64
+	Param        int64 // game specific, e.g. the lottery's ticket count
+	CreatedAt    time.Time
+}
+
+// Tournament is a slots tournament. Entrants' 🎰 spins score for it until
+// EndsAt, when the scheduler pays the entry fees in Pool out to the top three.
+type Tournament struct {
+	ID       uint  `gorm:"primaryKey"`
+	GroupID  int64 `gorm:"index"`
+	EntryFee int64
+	Pool     int64
+	EndsAt   time.Time
+	Ended    bool
+}
+
+// TournamentEntry is a player's paytable score in a tournament
+type TournamentEntry struct {
+	TournamentID uint  `gorm:"primaryKey"`
+	UserID       int64 `gorm:"primaryKey"`
+	GroupID      int64
+	Username     string
+	Score        int64
+	Spins        int64
+	JoinedAt     time.Time
+}
+
+// Season is a season of a group's slot and dice leaderboards. The running
+// season's row is opened by the first spin or roll after the last one ended.
+type Season struct {
+	ID        uint  `gorm:"primaryKey"`
+	GroupID   int64 `gorm:"index"`
+	Number    int   // counts from 1 within the group
+	StartedAt time.Time
+	EndedAt   time.Time
+	Ended     bool
+}
+
+// SeasonStats is a player's slot leaderboard row for one season.
+// SlotMachineStats keeps the lifetime totals.
+type SeasonStats struct {
+	SeasonID     uint  `gorm:"primaryKey"`
+	UserID       int64 `gorm:"primaryKey"`
+	GroupID      int64
+	Username     string
+	BarWins      int64
+	CherryWins   int64
+	LemonWins    int64
+	SevenWins    int64
+	TotalGames   int64
+	Score        int64
+	LastPlayedAt time.Time
+
+	// Final place, set when the season ends
+	Rank  int
+	Title string // set for the top finishers, see seasonTitles
+}
+
+// SeasonDiceStats is a player's leaderboard row for one season of one of
+// diceGames. DiceGameStats keeps the lifetime totals.
+type SeasonDiceStats struct {
+	SeasonID     uint   `gorm:"primaryKey"`
+	UserID       int64  `gorm:"primaryKey"`
+	Emoji        string `gorm:"primaryKey"`
+	GroupID      int64
+	Username     string
+	TotalGames   int64
+	Wins         int64
+	TopHits      int64
+	Score        int64
+	LastPlayedAt time.Time
+	Rank         int // final place, set when the season ends
+}
+
+// ScheduledMessage is a message the scheduler sends once SendAt has passed.
+// When EditMessageID is set it replaces that message's text instead.
+type ScheduledMessage struct {
+	ID            uint `gorm:"primaryKey"`
+	ChatID        int64
+	EditMessageID int
+	Text          string
+	SendAt        time.Time `gorm:"index"`
+
+	// Players the message is about, so resetting either of them drops it
+	UserID     int64
+	OpponentID int64
 }
 
-func OpenDB() (*DB, error) {
-	if err := os.MkdirAll("data", 0755); err != nil {
+// ScheduledDeletion is a chat message the scheduler deletes once DeleteAt has
+// passed. Rows survive restarts so no clean-up is lost.
+type ScheduledDeletion struct {
+	ID        uint `gorm:"primaryKey"`
+	ChatID    int64
+	MessageID int
+	DeleteAt  time.Time `gorm:"index"`
+}
+
+// GroupSettings holds per-group configuration. Groups without a row use
+// defaultGroupSettings.
+type GroupSettings struct {
+	GroupID int64 `gorm:"primaryKey"`
+
+	// How long spin messages stay in the chat; negative means never delete
+	LosingSpinCleanup  time.Duration
+	WinningSpinCleanup time.Duration
+
+	// Percentage of every slot bet that goes into the jackpot pool
+	JackpotCut int64
+
+	// Base amount paid by /daily before the streak bonus
+	DailyAllowance int64
+
+	// Most a player may /give away per 24 hours, 0 for no limit
+	GiveCap int64
+	// Percentage of every gift taken as tax, burned or paid into the group
+	// treasury
+	GiveTax           int64
+	GiveTaxToTreasury bool
+
+	// When the lottery is drawn, as a cron expression in UTC, and the
+	// percentage of the pot the house keeps
+	LotterySchedule string
+	LotteryCut      int64
+
+	// Whether the blackjack dealer draws on a soft 17
+	BlackjackHitSoft17 bool
+}
+
+func defaultGroupSettings(groupID int64) GroupSettings {
+	return GroupSettings{
+		GroupID:            groupID,
+		LosingSpinCleanup:  time.Minute,
+		WinningSpinCleanup: -1,
+		JackpotCut:         10,
+		DailyAllowance:     100,
+		GiveCap:            1000,
+		LotterySchedule:    "0 20 * * 0",
+		LotteryCut:         10,
+	}
+}
+
+// addedGroupSettings returns the GroupSettings columns added after groups
+// could already have settings, with the value existing rows get when the
+// column is created
+func addedGroupSettings() map[string]interface{} {
+	d := defaultGroupSettings(0)
+	return map[string]interface{}{
+		"jackpot_cut":      d.JackpotCut,
+		"daily_allowance":  d.DailyAllowance,
+		"give_cap":         d.GiveCap,
+		"lottery_schedule": d.LotterySchedule,
+		"lottery_cut":      d.LotteryCut,
+	}
+}
+
+// Treasury holds a group's collected gift taxes
+type Treasury struct {
+	GroupID int64 `gorm:"primaryKey"`
+	Amount  int64
+}
+
+// DailyClaim tracks a player's /daily claims and current streak
+type DailyClaim struct {
+	UserID      int64 `gorm:"primaryKey"`
+	GroupID     int64 `gorm:"primaryKey"`
+	LastClaimAt time.Time
+	Streak      int64
+}
+
+// JackpotPool is a group's progressive jackpot, fed by slot bets and won
+// whole by hitting three sevens on a wagered spin
+type JackpotPool struct {
+	GroupID       int64 `gorm:"primaryKey"`
+	Amount        int64
+	LastWinnerID  int64
+	LastWinner    string
+	LastWonAmount int64
+	LastWonAt     time.Time
+}
+
+// PaytableEntry prices one slot combo in a group, see Paytable. Groups
+// without entries use defaultPaytable.
+type PaytableEntry struct {
+	GroupID int64  `gorm:"primaryKey"`
+	Combo   string `gorm:"primaryKey"`
+	Points  int64
+}
+
+// AdminAction is an audit record of a change made by a group admin
+type AdminAction struct {
+	ID        uint  `gorm:"primaryKey"`
+	GroupID   int64 `gorm:"index"`
+	AdminID   int64
+	AdminName string
+	Action    string
+	TargetID  int64 // affected user, 0 for group-wide actions
+	Details   string
+	CreatedAt time.Time
+}
+
+// Ledger reasons recorded on LedgerEntry.Reason
+const (
+	ledgerOpeningBalance  = "opening_balance"
+	ledgerSlotBet         = "slot_bet"
+	ledgerSlotWin         = "slot_win"
+	ledgerJackpot         = "jackpot"
+	ledgerDaily           = "daily"
+	ledgerGift            = "gift"
+	ledgerGiftTax         = "gift_tax"
+	ledgerBlackjackBet    = "blackjack_bet"
+	ledgerBlackjackWin    = "blackjack_win"
+	ledgerRouletteBet     = "roulette_bet"
+	ledgerRouletteWin     = "roulette_win"
+	ledgerLotteryTicket   = "lottery_ticket"
+	ledgerLotteryWin      = "lottery_win"
+	ledgerFlipBet         = "flip_bet"
+	ledgerFlipWin         = "flip_win"
+	ledgerHiloBet         = "hilo_bet"
+	ledgerHiloWin         = "hilo_win"
+	ledgerCrashBet        = "crash_bet"
+	ledgerCrashWin        = "crash_win"
+	ledgerTournamentEntry = "tournament_entry"
+	ledgerTournamentPrize = "tournament_prize"
+	ledgerDuelStake       = "duel_stake"
+	ledgerDuelWin         = "duel_win"
+	ledgerDuelRefund      = "duel_refund"
+	ledgerAdminGrant      = "admin_grant"
+	ledgerAdminSet        = "admin_set"
+	ledgerAdminReset      = "admin_reset"
+	ledgerResetRefund     = "reset_refund"
+)
+
+// LedgerEntry records a single balance change. Entries are never updated or
+// deleted, so a balance always equals the sum of its entries' deltas.
+type LedgerEntry struct {
+	ID        uint  `gorm:"primaryKey"`
+	UserID    int64 `gorm:"index:idx_ledger_user_group"`
+	GroupID   int64 `gorm:"index:idx_ledger_user_group"`
+	Delta     int64
+	Reason    string
+	MessageID int // message that caused the change, 0 if none
+	CreatedAt time.Time
+}
+
+// LedgerMismatch is a balance that disagrees with the sum of its ledger
+type LedgerMismatch struct {
+	UserID  int64
+	Balance int64
+	Ledger  int64
+}
+
+func OpenDB(path string) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return nil, err
 	}
-	gormDB, err := gorm.Open(sqlite.Open("data/casino.db"), &gorm.Config{})
+	// Handlers for different groups and the scheduler write concurrently, so
+	// wait for SQLite's write lock instead of failing straight away
+	gormDB, err := gorm.Open(sqlite.Open(path+"?_busy_timeout=5000&_journal_mode=WAL"), &gorm.Config{})
 	if err != nil {
 		return nil, err
 	}
-	if err := gormDB.AutoMigrate(&SlotMachineStats{}, &Balance{}); err != nil {
+	backfill := map[string]interface{}{}
+	for column, value := range addedGroupSettings() {
+		if !gormDB.Migrator().HasColumn(&GroupSettings{}, column) {
+			backfill[column] = value
+		}
+	}
+	if err := gormDB.AutoMigrate(&SlotMachineStats{}, &Balance{}, &PendingDuel{}, &ScheduledMessage{}, &ScheduledDeletion{}, &GroupSettings{}, &AdminAction{}, &LedgerEntry{}, &PaytableEntry{}, &DiceGameStats{}, &JackpotPool{}, &DailyClaim{}, &Treasury{}, &BlackjackGame{}, &RouletteRound{}, &RouletteBet{}, &LotteryRound{}, &LotteryTicket{}, &HiloGame{}, &QuickGameStats{}, &CrashChain{}, &CrashRound{}, &CrashBet{}, &ServerSeed{}, &FairRound{}, &Tournament{}, &TournamentEntry{}, &Season{}, &SeasonStats{}, &SeasonDiceStats{}); err != nil {
+		return nil, err
+	}
+	db := &DB{gormDB}
+	if len(backfill) > 0 {
+		if err := db.Model(&GroupSettings{}).Where("1 = 1").Updates(backfill).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := db.backfillLedger(time.Now()); err != nil {
 		return nil, err
 	}
-	return &DB{gormDB}, nil
+	return db, nil
 }
 
 func (db *DB) GetOrCreateStats(userID, groupID int64, username string) (*SlotMachineStats, error) {
@@ -77,6 +525,29 @@ type StatsDelta struct {
 	BarWins    int
 	CherryWins int
 	LemonWins  int
+
+	// Dice games only, see DiceGameStats
+	Wins    int
+	TopHits int
+}
+
+// EnsureDiceGameStats creates a player's dice game stats within tx unless
+// they already exist
+func (db *DB) EnsureDiceGameStats(tx *gorm.DB, userID, groupID int64, emoji, username string) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&DiceGameStats{UserID: userID, GroupID: groupID, Emoji: emoji, Username: username}).Error
+}
+
+func (db *DB) UpdateDiceGameStats(tx *gorm.DB, userID, groupID int64, emoji string, lastPlayedAt time.Time, delta StatsDelta) error {
+	return tx.Model(&DiceGameStats{}).
+		Where("user_id = ? AND group_id = ? AND emoji = ?", userID, groupID, emoji).
+		Updates(map[string]interface{}{
+			"total_games":    gorm.Expr("total_games + ?", delta.TotalGames),
+			"wins":           gorm.Expr("wins + ?", delta.Wins),
+			"top_hits":       gorm.Expr("top_hits + ?", delta.TopHits),
+			"score":          gorm.Expr("score + ?", delta.Score),
+			"last_played_at": lastPlayedAt,
+		}).Error
 }
 
 func (db *DB) GetOrCreateBalance(userID, groupID int64) (*Balance, error) {
@@ -95,10 +566,25 @@ func (db *DB) GetOrCreateBalance(userID, groupID int64) (*Balance, error) {
 	return &b, nil
 }
 
-func (db *DB) UpdateBalance(tx *gorm.DB, userID, groupID int64, amountDelta int) error {
-	return tx.Model(&Balance{}).
-		Where("user_id = ? AND group_id = ?", userID, groupID).
-		Update("amount", gorm.Expr("amount + ?", amountDelta)).Error
+// UpdateBalance applies entry.Delta to the entry's balance and appends the
+// entry to the ledger. Zero deltas are skipped.
+func (db *DB) UpdateBalance(tx *gorm.DB, entry LedgerEntry) error {
+	if entry.Delta == 0 {
+		return nil
+	}
+	if err := tx.Model(&Balance{}).
+		Where("user_id = ? AND group_id = ?", entry.UserID, entry.GroupID).
+		Update("amount", gorm.Expr("amount + ?", entry.Delta)).Error; err != nil {
+		return err
+	}
+	return tx.Create(&entry).Error
+}
+
+// EnsureStats creates a player's slot stats within tx unless they already
+// exist
+func (db *DB) EnsureStats(tx *gorm.DB, userID, groupID int64, username string) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&SlotMachineStats{UserID: userID, GroupID: groupID, Username: username}).Error
 }
 
 func (db *DB) UpdateStats(tx *gorm.DB, userID, groupID int64, lastPlayedAt time.Time, delta StatsDelta) error {
@@ -127,13 +613,1023 @@ func (db *DB) GetBalancesByGroup(groupID int64) ([]Balance, error) {
 	return results, err
 }
 
-func (db *DB) TransferBalance(tx *gorm.DB, fromUserID, toUserID, groupID int64, amount int64) error {
-	if err := tx.Model(&Balance{}).
-		Where("user_id = ? AND group_id = ?", fromUserID, groupID).
-		Update("amount", gorm.Expr("amount - ?", amount)).Error; err != nil {
+// TransferBalance moves entry.Delta from fromUserID to toUserID, recording
+// both sides in the ledger under entry's reason.
+func (db *DB) TransferBalance(tx *gorm.DB, fromUserID, toUserID int64, entry LedgerEntry) error {
+	from, to := entry, entry
+	from.UserID, from.Delta = fromUserID, -entry.Delta
+	to.UserID = toUserID
+	if err := db.UpdateBalance(tx, from); err != nil {
 		return err
 	}
-	return tx.Model(&Balance{}).
-		Where("user_id = ? AND group_id = ?", toUserID, groupID).
-		Update("amount", gorm.Expr("amount + ?", amount)).Error
+	return db.UpdateBalance(tx, to)
+}
+
+func (db *DB) GetPendingDuel(tx *gorm.DB, id uint) (*PendingDuel, error) {
+	var d PendingDuel
+	if err := tx.First(&d, id).Error; err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (db *DB) SetDuelMessageID(tx *gorm.DB, id uint, messageID int) error {
+	return tx.Model(&PendingDuel{}).Where("id = ?", id).Update("message_id", messageID).Error
+}
+
+// GetIncomingDuels returns the open challenges addressed to targetID.
+func (db *DB) GetIncomingDuels(tx *gorm.DB, groupID, targetID int64, now time.Time) ([]PendingDuel, error) {
+	var results []PendingDuel
+	err := tx.Where("group_id = ? AND target_id = ? AND accepted = ? AND expires_at > ?", groupID, targetID, false, now).
+		Order("id").Find(&results).Error
+	return results, err
+}
+
+// GetOutgoingDuels returns the open challenges issued by initiatorID.
+func (db *DB) GetOutgoingDuels(tx *gorm.DB, groupID, initiatorID int64, now time.Time) ([]PendingDuel, error) {
+	var results []PendingDuel
+	err := tx.Where("group_id = ? AND initiator_id = ? AND accepted = ? AND expires_at > ?", groupID, initiatorID, false, now).
+		Order("id").Find(&results).Error
+	return results, err
+}
+
+func (db *DB) CreatePendingDuel(tx *gorm.DB, duel *PendingDuel) error {
+	return tx.Create(duel).Error
+}
+
+func (db *DB) DeletePendingDuel(tx *gorm.DB, id uint) error {
+	return tx.Delete(&PendingDuel{}, id).Error
+}
+
+// GetExpiredDuels returns the unaccepted duels that expired before now
+func (db *DB) GetExpiredDuels(now time.Time) ([]PendingDuel, error) {
+	var expired []PendingDuel
+	err := db.Where("expires_at <= ? AND accepted = ?", now, false).Order("id").Find(&expired).Error
+	return expired, err
+}
+
+// ExpireDuel removes a duel if it is still unaccepted and expired before now,
+// reporting whether it did
+func (db *DB) ExpireDuel(id uint, now time.Time) (bool, error) {
+	result := db.Where("id = ? AND expires_at <= ? AND accepted = ?", id, now, false).Delete(&PendingDuel{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (db *DB) GetBlackjackGame(tx *gorm.DB, id uint) (*BlackjackGame, error) {
+	var g BlackjackGame
+	if err := tx.First(&g, id).Error; err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// GetActiveBlackjackGame returns the game a player is still playing in a group
+func (db *DB) GetActiveBlackjackGame(tx *gorm.DB, groupID, userID int64) (*BlackjackGame, error) {
+	var g BlackjackGame
+	if err := tx.Where("group_id = ? AND user_id = ?", groupID, userID).First(&g).Error; err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (db *DB) CreateBlackjackGame(tx *gorm.DB, g *BlackjackGame) error {
+	return tx.Create(g).Error
+}
+
+func (db *DB) SaveBlackjackGame(tx *gorm.DB, g *BlackjackGame) error {
+	return tx.Save(g).Error
+}
+
+func (db *DB) SetBlackjackMessageID(tx *gorm.DB, id uint, messageID int) error {
+	return tx.Model(&BlackjackGame{}).Where("id = ?", id).Update("message_id", messageID).Error
+}
+
+func (db *DB) DeleteBlackjackGame(tx *gorm.DB, id uint) error {
+	return tx.Delete(&BlackjackGame{}, id).Error
+}
+
+// GetOpenRouletteRound returns the round taking bets in a group
+func (db *DB) GetOpenRouletteRound(tx *gorm.DB, groupID int64) (*RouletteRound, error) {
+	var r RouletteRound
+	if err := tx.Where("group_id = ?", groupID).First(&r).Error; err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetClosedRouletteRounds returns the rounds whose betting window is over
+func (db *DB) GetClosedRouletteRounds(now time.Time) ([]RouletteRound, error) {
+	var results []RouletteRound
+	err := db.Where("closes_at <= ?", now).Order("id").Find(&results).Error
+	return results, err
+}
+
+func (db *DB) CreateRouletteRound(tx *gorm.DB, r *RouletteRound) error {
+	return tx.Create(r).Error
+}
+
+// DeleteRouletteRound removes a round and its bets
+func (db *DB) DeleteRouletteRound(tx *gorm.DB, id uint) error {
+	if err := tx.Where("round_id = ?", id).Delete(&RouletteBet{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&RouletteRound{}, id).Error
+}
+
+func (db *DB) GetRouletteBets(tx *gorm.DB, roundID uint) ([]RouletteBet, error) {
+	var results []RouletteBet
+	err := tx.Where("round_id = ?", roundID).Order("id").Find(&results).Error
+	return results, err
+}
+
+func (db *DB) CreateRouletteBet(tx *gorm.DB, bet *RouletteBet) error {
+	return tx.Create(bet).Error
+}
+
+// GetOpenLotteryRound returns the group's lottery round not yet drawn
+func (db *DB) GetOpenLotteryRound(tx *gorm.DB, groupID int64) (*LotteryRound, error) {
+	var r LotteryRound
+	if err := tx.Where("group_id = ? AND drawn = ?", groupID, false).First(&r).Error; err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetLastLotteryDraw returns the group's most recent drawn round with a winner
+func (db *DB) GetLastLotteryDraw(groupID int64) (*LotteryRound, error) {
+	var r LotteryRound
+	if err := db.Where("group_id = ? AND drawn = ? AND winner_id != 0", groupID, true).Order("id DESC").First(&r).Error; err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetDueLotteryRounds returns the open rounds whose draw time has come
+func (db *DB) GetDueLotteryRounds(now time.Time) ([]LotteryRound, error) {
+	var results []LotteryRound
+	err := db.Where("drawn = ? AND draw_at <= ?", false, now).Order("id").Find(&results).Error
+	return results, err
+}
+
+func (db *DB) SaveLotteryRound(tx *gorm.DB, r *LotteryRound) error {
+	return tx.Save(r).Error
+}
+
+func (db *DB) GetLotteryTickets(tx *gorm.DB, roundID uint) ([]LotteryTicket, error) {
+	var results []LotteryTicket
+	err := tx.Where("round_id = ?", roundID).Order("user_id").Find(&results).Error
+	return results, err
+}
+
+// AddLotteryTickets adds t.Count tickets to the player's holding in the round
+func (db *DB) AddLotteryTickets(tx *gorm.DB, t *LotteryTicket) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "round_id"}, {Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("count + ?", t.Count), "username": t.Username}),
+	}).Create(t).Error
+}
+
+func (db *DB) GetHiloGame(tx *gorm.DB, id uint) (*HiloGame, error) {
+	var g HiloGame
+	if err := tx.First(&g, id).Error; err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// GetActiveHiloGame returns the game of higher or lower a player is still
+// playing in a group
+func (db *DB) GetActiveHiloGame(tx *gorm.DB, groupID, userID int64) (*HiloGame, error) {
+	var g HiloGame
+	if err := tx.Where("group_id = ? AND user_id = ?", groupID, userID).First(&g).Error; err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (db *DB) CreateHiloGame(tx *gorm.DB, g *HiloGame) error {
+	return tx.Create(g).Error
+}
+
+func (db *DB) SaveHiloGame(tx *gorm.DB, g *HiloGame) error {
+	return tx.Save(g).Error
+}
+
+func (db *DB) SetHiloMessageID(tx *gorm.DB, id uint, messageID int) error {
+	return tx.Model(&HiloGame{}).Where("id = ?", id).Update("message_id", messageID).Error
+}
+
+func (db *DB) DeleteHiloGame(tx *gorm.DB, id uint) error {
+	return tx.Delete(&HiloGame{}, id).Error
+}
+
+// RecordQuickGame adds s's counts to the player's stats for s.Game
+func (db *DB) RecordQuickGame(tx *gorm.DB, s *QuickGameStats) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "group_id"}, {Name: "game"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"username":       s.Username,
+			"played":         gorm.Expr("played + ?", s.Played),
+			"won":            gorm.Expr("won + ?", s.Won),
+			"wagered":        gorm.Expr("wagered + ?", s.Wagered),
+			"returned":       gorm.Expr("returned + ?", s.Returned),
+			"last_played_at": s.LastPlayedAt,
+		}),
+	}).Create(s).Error
+}
+
+func (db *DB) GetQuickGameStatsByGroup(groupID int64, game string) ([]QuickGameStats, error) {
+	var results []QuickGameStats
+	err := db.Where("group_id = ? AND game = ?", groupID, game).Find(&results).Error
+	return results, err
+}
+
+func (db *DB) GetCrashChain(tx *gorm.DB, groupID int64) (*CrashChain, error) {
+	var chain CrashChain
+	if err := tx.Where("group_id = ?", groupID).First(&chain).Error; err != nil {
+		return nil, err
+	}
+	return &chain, nil
+}
+
+func (db *DB) SaveCrashChain(tx *gorm.DB, chain *CrashChain) error {
+	return tx.Save(chain).Error
+}
+
+func (db *DB) GetCrashRound(tx *gorm.DB, id uint) (*CrashRound, error) {
+	var r CrashRound
+	if err := tx.First(&r, id).Error; err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetActiveCrashRound returns the group's round that hasn't crashed yet
+func (db *DB) GetActiveCrashRound(tx *gorm.DB, groupID int64) (*CrashRound, error) {
+	var r CrashRound
+	if err := tx.Where("group_id = ? AND crashed = ?", groupID, false).First(&r).Error; err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetLaunchedCrashRounds returns the rounds in flight
+func (db *DB) GetLaunchedCrashRounds(now time.Time) ([]CrashRound, error) {
+	var results []CrashRound
+	err := db.Where("crashed = ? AND starts_at <= ?", false, now).Order("id").Find(&results).Error
+	return results, err
+}
+
+// GetCrashedRounds returns a group's most recent crashed rounds, newest first
+func (db *DB) GetCrashedRounds(groupID int64, limit int) ([]CrashRound, error) {
+	var results []CrashRound
+	err := db.Where("group_id = ? AND crashed = ?", groupID, true).Order("id DESC").Limit(limit).Find(&results).Error
+	return results, err
+}
+
+func (db *DB) CreateCrashRound(tx *gorm.DB, r *CrashRound) error {
+	return tx.Create(r).Error
+}
+
+func (db *DB) SaveCrashRound(tx *gorm.DB, r *CrashRound) error {
+	return tx.Save(r).Error
+}
+
+func (db *DB) SetCrashMessageID(tx *gorm.DB, id uint, messageID int) error {
+	return tx.Model(&CrashRound{}).Where("id = ?", id).Update("message_id", messageID).Error
+}
+
+func (db *DB) GetCrashBets(tx *gorm.DB, roundID uint) ([]CrashBet, error) {
+	var results []CrashBet
+	err := tx.Where("round_id = ?", roundID).Order("id").Find(&results).Error
+	return results, err
+}
+
+func (db *DB) CreateCrashBet(tx *gorm.DB, bet *CrashBet) error {
+	return tx.Create(bet).Error
+}
+
+func (db *DB) SaveCrashBet(tx *gorm.DB, bet *CrashBet) error {
+	return tx.Save(bet).Error
+}
+
+// GetActiveServerSeed returns the server seed a group's games currently use
+func (db *DB) GetActiveServerSeed(tx *gorm.DB, groupID int64) (*ServerSeed, error) {
+	var s ServerSeed
+	if err := tx.Where("group_id = ? AND active = ?", groupID, true).First(&s).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (db *DB) GetServerSeed(tx *gorm.DB, id uint) (*ServerSeed, error) {
+	var s ServerSeed
+	if err := tx.First(&s, id).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (db *DB) SaveServerSeed(tx *gorm.DB, s *ServerSeed) error {
+	return tx.Save(s).Error
+}
+
+func (db *DB) GetFairRound(tx *gorm.DB, groupID int64, id uint) (*FairRound, error) {
+	var r FairRound
+	if err := tx.Where("group_id = ?", groupID).First(&r, id).Error; err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (db *DB) CreateFairRound(tx *gorm.DB, r *FairRound) error {
+	return tx.Create(r).Error
+}
+
+// ServerSeedInPlay reports whether a hilo or blackjack game is still being
+// played from a draw on a server seed
+func (db *DB) ServerSeedInPlay(tx *gorm.DB, serverSeedID uint) (bool, error) {
+	rounds := tx.Model(&FairRound{}).Select("id").Where("server_seed_id = ?", serverSeedID)
+	for _, model := range []any{&HiloGame{}, &BlackjackGame{}} {
+		var n int64
+		if err := tx.Model(model).Where("fair_round_id IN (?)", rounds).Count(&n).Error; err != nil {
+			return false, err
+		}
+		if n > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetRunningTournament returns the group's tournament not yet ended
+func (db *DB) GetRunningTournament(tx *gorm.DB, groupID int64) (*Tournament, error) {
+	var t Tournament
+	if err := tx.Where("group_id = ? AND ended = ?", groupID, false).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetDueTournaments returns the running tournaments whose time is up
+func (db *DB) GetDueTournaments(now time.Time) ([]Tournament, error) {
+	var results []Tournament
+	err := db.Where("ended = ? AND ends_at <= ?", false, now).Order("id").Find(&results).Error
+	return results, err
+}
+
+func (db *DB) SaveTournament(tx *gorm.DB, t *Tournament) error {
+	return tx.Save(t).Error
+}
+
+func (db *DB) GetTournamentEntry(tx *gorm.DB, tournamentID uint, userID int64) (*TournamentEntry, error) {
+	var e TournamentEntry
+	if err := tx.Where("tournament_id = ? AND user_id = ?", tournamentID, userID).First(&e).Error; err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (db *DB) GetTournamentEntries(tx *gorm.DB, tournamentID uint) ([]TournamentEntry, error) {
+	var results []TournamentEntry
+	err := tx.Where("tournament_id = ?", tournamentID).Order("joined_at").Find(&results).Error
+	return results, err
+}
+
+func (db *DB) CreateTournamentEntry(tx *gorm.DB, e *TournamentEntry) error {
+	return tx.Create(e).Error
+}
+
+// GetLastSeason returns the group's most recently ended season
+func (db *DB) GetLastSeason(tx *gorm.DB, groupID int64) (*Season, error) {
+	var season Season
+	if err := tx.Where("group_id = ? AND ended = ?", groupID, true).Order("number DESC").First(&season).Error; err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// GetRunningSeason returns the group's season not yet ended, if anyone has
+// played since the last one
+func (db *DB) GetRunningSeason(tx *gorm.DB, groupID int64) (*Season, error) {
+	var season Season
+	if err := tx.Where("group_id = ? AND ended = ?", groupID, false).First(&season).Error; err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// GetOrStartSeason returns the group's running season, opening the next one
+// at at if there is none
+func (db *DB) GetOrStartSeason(tx *gorm.DB, groupID int64, at time.Time) (*Season, error) {
+	season, err := db.GetRunningSeason(tx, groupID)
+	if err != gorm.ErrRecordNotFound {
+		return season, err
+	}
+
+	season = &Season{GroupID: groupID, Number: 1, StartedAt: at}
+	last, err := db.GetLastSeason(tx, groupID)
+	if err == nil {
+		season.Number = last.Number + 1
+		season.StartedAt = last.EndedAt
+	} else if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	if err := tx.Create(season).Error; err != nil {
+		return nil, err
+	}
+	return season, nil
+}
+
+func (db *DB) GetSeason(groupID int64, number int) (*Season, error) {
+	var season Season
+	if err := db.Where("group_id = ? AND number = ?", groupID, number).First(&season).Error; err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+func (db *DB) SaveSeason(tx *gorm.DB, season *Season) error {
+	return tx.Save(season).Error
+}
+
+// AddSeasonStats adds a spin to the player's slot stats for the group's
+// running season
+func (db *DB) AddSeasonStats(tx *gorm.DB, userID, groupID int64, username string, lastPlayedAt time.Time, delta StatsDelta) error {
+	season, err := db.GetOrStartSeason(tx, groupID, lastPlayedAt)
+	if err != nil {
+		return err
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&SeasonStats{SeasonID: season.ID, UserID: userID, GroupID: groupID}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&SeasonStats{}).
+		Where("season_id = ? AND user_id = ?", season.ID, userID).
+		Updates(map[string]interface{}{
+			"username":       username,
+			"total_games":    gorm.Expr("total_games + ?", delta.TotalGames),
+			"score":          gorm.Expr("score + ?", delta.Score),
+			"seven_wins":     gorm.Expr("seven_wins + ?", delta.SevenWins),
+			"bar_wins":       gorm.Expr("bar_wins + ?", delta.BarWins),
+			"cherry_wins":    gorm.Expr("cherry_wins + ?", delta.CherryWins),
+			"lemon_wins":     gorm.Expr("lemon_wins + ?", delta.LemonWins),
+			"last_played_at": lastPlayedAt,
+		}).Error
+}
+
+// AddSeasonDiceStats adds a roll to the player's stats in a dice game for
+// the group's running season
+func (db *DB) AddSeasonDiceStats(tx *gorm.DB, userID, groupID int64, emoji, username string, lastPlayedAt time.Time, delta StatsDelta) error {
+	season, err := db.GetOrStartSeason(tx, groupID, lastPlayedAt)
+	if err != nil {
+		return err
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&SeasonDiceStats{SeasonID: season.ID, UserID: userID, Emoji: emoji, GroupID: groupID}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&SeasonDiceStats{}).
+		Where("season_id = ? AND user_id = ? AND emoji = ?", season.ID, userID, emoji).
+		Updates(map[string]interface{}{
+			"username":       username,
+			"total_games":    gorm.Expr("total_games + ?", delta.TotalGames),
+			"wins":           gorm.Expr("wins + ?", delta.Wins),
+			"top_hits":       gorm.Expr("top_hits + ?", delta.TopHits),
+			"score":          gorm.Expr("score + ?", delta.Score),
+			"last_played_at": lastPlayedAt,
+		}).Error
+}
+
+// GetSeasonStats returns a season's slot stats, in final order once it has
+// ended
+func (db *DB) GetSeasonStats(tx *gorm.DB, seasonID uint) ([]SeasonStats, error) {
+	var results []SeasonStats
+	err := tx.Where("season_id = ?", seasonID).Order("rank").Find(&results).Error
+	return results, err
+}
+
+// GetSeasonDiceStats returns a season's stats in a dice game, in final order
+// once it has ended
+func (db *DB) GetSeasonDiceStats(tx *gorm.DB, seasonID uint, emoji string) ([]SeasonDiceStats, error) {
+	var results []SeasonDiceStats
+	err := tx.Where("season_id = ? AND emoji = ?", seasonID, emoji).Order("rank").Find(&results).Error
+	return results, err
+}
+
+// GetRunningSeasonStats returns the slot stats of the group's running
+// season, none if nobody has played since the last one ended
+func (db *DB) GetRunningSeasonStats(groupID int64) ([]SeasonStats, error) {
+	season, err := db.GetRunningSeason(db.DB, groupID)
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db.GetSeasonStats(db.DB, season.ID)
+}
+
+// GetRunningSeasonDiceStats returns the stats in a dice game of the group's
+// running season, none if nobody has played since the last one ended
+func (db *DB) GetRunningSeasonDiceStats(groupID int64, emoji string) ([]SeasonDiceStats, error) {
+	season, err := db.GetRunningSeason(db.DB, groupID)
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db.GetSeasonDiceStats(db.DB, season.ID, emoji)
+}
+
+func (db *DB) SaveSeasonStats(tx *gorm.DB, stats []SeasonStats) error {
+	return tx.Save(&stats).Error
+}
+
+func (db *DB) SaveSeasonDiceStats(tx *gorm.DB, stats []SeasonDiceStats) error {
+	return tx.Save(&stats).Error
+}
+
+// AddTournamentScore adds a spin scoring score to the player's entry in the
+// group's running tournament, if they entered one that hasn't ended by at
+func (db *DB) AddTournamentScore(tx *gorm.DB, userID, groupID int64, at time.Time, score int64) error {
+	running := tx.Model(&Tournament{}).Select("id").Where("group_id = ? AND ended = ? AND ends_at > ?", groupID, false, at)
+	return tx.Model(&TournamentEntry{}).
+		Where("user_id = ? AND tournament_id IN (?)", userID, running).
+		Updates(map[string]interface{}{
+			"score": gorm.Expr("score + ?", score),
+			"spins": gorm.Expr("spins + 1"),
+		}).Error
+}
+
+func (db *DB) GetAcceptedDuels() ([]PendingDuel, error) {
+	var results []PendingDuel
+	err := db.Where("accepted = ?", true).Find(&results).Error
+	return results, err
+}
+
+// EscrowDuelStakes takes both stakes out of the players' balances and records
+// them on the duel until it is settled or refunded.
+func (db *DB) EscrowDuelStakes(tx *gorm.DB, duel *PendingDuel, initiatorStake, targetStake int64, now time.Time) error {
+	if err := db.UpdateBalance(tx, duel.ledgerEntry(duel.InitiatorID, -initiatorStake, ledgerDuelStake, now)); err != nil {
+		return err
+	}
+	if err := db.UpdateBalance(tx, duel.ledgerEntry(duel.TargetID, -targetStake, ledgerDuelStake, now)); err != nil {
+		return err
+	}
+	duel.Accepted = true
+	duel.InitiatorEscrow = initiatorStake
+	duel.TargetEscrow = targetStake
+	return tx.Model(duel).Select("accepted", "initiator_escrow", "target_escrow").Updates(duel).Error
+}
+
+// RefundDuel returns escrowed stakes to both players and removes the duel.
+func (db *DB) RefundDuel(tx *gorm.DB, duel *PendingDuel, now time.Time) error {
+	if err := db.UpdateBalance(tx, duel.ledgerEntry(duel.InitiatorID, duel.InitiatorEscrow, ledgerDuelRefund, now)); err != nil {
+		return err
+	}
+	if err := db.UpdateBalance(tx, duel.ledgerEntry(duel.TargetID, duel.TargetEscrow, ledgerDuelRefund, now)); err != nil {
+		return err
+	}
+	return db.DeletePendingDuel(tx, duel.ID)
+}
+
+// ledgerEntry builds a ledger entry referencing the duel's challenge message
+func (d *PendingDuel) ledgerEntry(userID, delta int64, reason string, now time.Time) LedgerEntry {
+	return LedgerEntry{
+		UserID:    userID,
+		GroupID:   d.GroupID,
+		Delta:     delta,
+		Reason:    reason,
+		MessageID: d.MessageID,
+		CreatedAt: now,
+	}
+}
+
+func (db *DB) ScheduleMessage(tx *gorm.DB, msg *ScheduledMessage) error {
+	return tx.Create(msg).Error
+}
+
+// GetDueMessages returns scheduled messages whose time has come, oldest first.
+func (db *DB) GetDueMessages(now time.Time) ([]ScheduledMessage, error) {
+	var results []ScheduledMessage
+	err := db.Where("send_at <= ?", now).Order("send_at, id").Find(&results).Error
+	return results, err
+}
+
+// ClaimScheduledMessage removes a due message before it is delivered,
+// reporting whether it was still scheduled
+func (db *DB) ClaimScheduledMessage(id uint) (bool, error) {
+	result := db.Delete(&ScheduledMessage{}, id)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (db *DB) GetGroupSettings(groupID int64) (*GroupSettings, error) {
+	var gs GroupSettings
+	result := db.Where("group_id = ?", groupID).First(&gs)
+	if result.Error == gorm.ErrRecordNotFound {
+		gs = defaultGroupSettings(groupID)
+		return &gs, nil
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &gs, nil
+}
+
+func (db *DB) SaveGroupSettings(tx *gorm.DB, gs *GroupSettings) error {
+	return tx.Save(gs).Error
+}
+
+// GetDailyClaim returns a player's daily claim record, or a zero record if
+// they never claimed
+func (db *DB) GetDailyClaim(tx *gorm.DB, userID, groupID int64) (*DailyClaim, error) {
+	var d DailyClaim
+	result := tx.Where("user_id = ? AND group_id = ?", userID, groupID).First(&d)
+	if result.Error == gorm.ErrRecordNotFound {
+		return &DailyClaim{UserID: userID, GroupID: groupID}, nil
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &d, nil
+}
+
+func (db *DB) SaveDailyClaim(tx *gorm.DB, d *DailyClaim) error {
+	return tx.Save(d).Error
+}
+
+// GetGivenSince returns how much a player has given away, tax included,
+// after the given time
+func (db *DB) GetGivenSince(tx *gorm.DB, userID, groupID int64, since time.Time) (int64, error) {
+	var given int64
+	err := tx.Model(&LedgerEntry{}).
+		Where("user_id = ? AND group_id = ? AND reason IN ? AND delta < 0 AND created_at > ?",
+			userID, groupID, []string{ledgerGift, ledgerGiftTax}, since).
+		Select("COALESCE(SUM(-delta), 0)").Scan(&given).Error
+	return given, err
+}
+
+func (db *DB) GetTreasury(tx *gorm.DB, groupID int64) (*Treasury, error) {
+	var t Treasury
+	result := tx.Where("group_id = ?", groupID).First(&t)
+	if result.Error == gorm.ErrRecordNotFound {
+		return &Treasury{GroupID: groupID}, nil
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &t, nil
+}
+
+func (db *DB) AddToTreasury(tx *gorm.DB, groupID, amount int64) error {
+	return tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{"amount": gorm.Expr("amount + ?", amount)}),
+	}).Create(&Treasury{GroupID: groupID, Amount: amount}).Error
+}
+
+// GetJackpotPool returns a group's jackpot, empty if nobody has fed it yet
+func (db *DB) GetJackpotPool(tx *gorm.DB, groupID int64) (*JackpotPool, error) {
+	var p JackpotPool
+	result := tx.Where("group_id = ?", groupID).First(&p)
+	if result.Error == gorm.ErrRecordNotFound {
+		return &JackpotPool{GroupID: groupID}, nil
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &p, nil
+}
+
+func (db *DB) SaveJackpotPool(tx *gorm.DB, p *JackpotPool) error {
+	return tx.Save(p).Error
+}
+
+func (db *DB) GetPaytable(tx *gorm.DB, groupID int64) (Paytable, error) {
+	var entries []PaytableEntry
+	if err := tx.Where("group_id = ?", groupID).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return defaultPaytable(), nil
+	}
+	p := Paytable{}
+	for _, e := range entries {
+		p[e.Combo] = e.Points
+	}
+	return p, nil
+}
+
+// SavePaytable replaces a group's paytable. Saving a nil paytable restores
+// the default one.
+func (db *DB) SavePaytable(tx *gorm.DB, groupID int64, p Paytable) error {
+	if err := tx.Where("group_id = ?", groupID).Delete(&PaytableEntry{}).Error; err != nil {
+		return err
+	}
+	for combo, points := range p {
+		if err := tx.Create(&PaytableEntry{GroupID: groupID, Combo: combo, Points: points}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) ScheduleDeletion(tx *gorm.DB, d *ScheduledDeletion) error {
+	return tx.Create(d).Error
+}
+
+// GetDueDeletions returns scheduled deletions whose time has come.
+func (db *DB) GetDueDeletions(now time.Time) ([]ScheduledDeletion, error) {
+	var results []ScheduledDeletion
+	err := db.Where("delete_at <= ?", now).Order("delete_at, id").Find(&results).Error
+	return results, err
+}
+
+// ClaimScheduledDeletion removes a due deletion before it is carried out,
+// reporting whether it was still scheduled
+func (db *DB) ClaimScheduledDeletion(id uint) (bool, error) {
+	result := db.Delete(&ScheduledDeletion{}, id)
+	return result.RowsAffected > 0, result.Error
+}
+
+// RecordCheatAttempt bumps the user's cheat counter and returns the new total.
+func (db *DB) RecordCheatAttempt(tx *gorm.DB, userID, groupID int64) (int64, error) {
+	if err := tx.Model(&SlotMachineStats{}).
+		Where("user_id = ? AND group_id = ?", userID, groupID).
+		Update("cheat_attempts", gorm.Expr("cheat_attempts + 1")).Error; err != nil {
+		return 0, err
+	}
+	var u SlotMachineStats
+	if err := tx.Where("user_id = ? AND group_id = ?", userID, groupID).First(&u).Error; err != nil {
+		return 0, err
+	}
+	return u.CheatAttempts, nil
+}
+
+func (db *DB) GetBalance(tx *gorm.DB, userID, groupID int64) (*Balance, error) {
+	var b Balance
+	if err := tx.Where("user_id = ? AND group_id = ?", userID, groupID).First(&b).Error; err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (db *DB) SetBet(tx *gorm.DB, userID, groupID int64, bet int64) error {
+	return tx.Model(&Balance{}).
+		Where("user_id = ? AND group_id = ?", userID, groupID).
+		Update("bet", bet).Error
+}
+
+// SetBalance sets a balance to entry.Delta, recording the difference from
+// the current amount in the ledger.
+func (db *DB) SetBalance(tx *gorm.DB, entry LedgerEntry) error {
+	current, err := db.GetBalance(tx, entry.UserID, entry.GroupID)
+	if err != nil {
+		return err
+	}
+	entry.Delta -= current.Amount
+	return db.UpdateBalance(tx, entry)
+}
+
+// FindUserByUsername looks a player up by the username recorded with their
+// slot or dice game stats. It returns gorm.ErrRecordNotFound for unknown
+// players.
+func (db *DB) FindUserByUsername(groupID int64, username string) (*SlotMachineStats, error) {
+	var u SlotMachineStats
+	err := db.Where("group_id = ? AND username = ?", groupID, username).First(&u).Error
+	if err == gorm.ErrRecordNotFound {
+		var s DiceGameStats
+		if err := db.Where("group_id = ? AND username = ?", groupID, username).First(&s).Error; err != nil {
+			return nil, err
+		}
+		return &SlotMachineStats{UserID: s.UserID, GroupID: s.GroupID, Username: s.Username}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ResetUser removes a player's stats and balance in a group. The ledger keeps
+// their history and gets an entry zeroing the removed balance.
+func (db *DB) ResetUser(tx *gorm.DB, userID, groupID int64, now time.Time) error {
+	if err := db.refundHeldStakes(tx, userID, groupID, now); err != nil {
+		return err
+	}
+	if err := tx.Where("chat_id = ? AND (user_id = ? OR opponent_id = ?)", groupID, userID, userID).Delete(&ScheduledMessage{}).Error; err != nil {
+		return err
+	}
+	for _, model := range []interface{}{&SlotMachineStats{}, &DiceGameStats{}, &DailyClaim{}, &QuickGameStats{}, &SeasonStats{}, &SeasonDiceStats{}} {
+		if err := tx.Where("user_id = ? AND group_id = ?", userID, groupID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return db.resetBalances(tx, now, "user_id = ? AND group_id = ?", userID, groupID)
+}
+
+// refundHeldStakes takes a player out of every game still holding their
+// money and returns it to the balance, so nothing is paid to them after
+// the balance is reset. Duels also refund the opponent.
+func (db *DB) refundHeldStakes(tx *gorm.DB, userID, groupID int64, now time.Time) error {
+	refund := func(amount int64) error {
+		return db.UpdateBalance(tx, LedgerEntry{
+			UserID:    userID,
+			GroupID:   groupID,
+			Delta:     amount,
+			Reason:    ledgerResetRefund,
+			CreatedAt: now,
+		})
+	}
+
+	var duels []PendingDuel
+	if err := tx.Where("group_id = ? AND (initiator_id = ? OR target_id = ?)", groupID, userID, userID).Find(&duels).Error; err != nil {
+		return err
+	}
+	for i := range duels {
+		if err := db.RefundDuel(tx, &duels[i], now); err != nil {
+			return err
+		}
+	}
+
+	var blackjack []BlackjackGame
+	if err := tx.Where("group_id = ? AND user_id = ?", groupID, userID).Find(&blackjack).Error; err != nil {
+		return err
+	}
+	for _, g := range blackjack {
+		for _, h := range g.Hands {
+			if err := refund(h.Bet); err != nil {
+				return err
+			}
+		}
+	}
+
+	var hilo []HiloGame
+	if err := tx.Where("group_id = ? AND user_id = ?", groupID, userID).Find(&hilo).Error; err != nil {
+		return err
+	}
+	for _, g := range hilo {
+		if err := refund(g.Bet); err != nil {
+			return err
+		}
+	}
+
+	var roulette []RouletteBet
+	if err := tx.Where("group_id = ? AND user_id = ?", groupID, userID).Find(&roulette).Error; err != nil {
+		return err
+	}
+	for _, bet := range roulette {
+		if err := refund(bet.Amount); err != nil {
+			return err
+		}
+	}
+
+	var crash []CrashBet
+	if err := tx.Where("group_id = ? AND user_id = ? AND round_id IN (?)", groupID, userID,
+		tx.Model(&CrashRound{}).Select("id").Where("crashed = ?", false)).Find(&crash).Error; err != nil {
+		return err
+	}
+	for _, bet := range crash {
+		if bet.CashedOut != 0 {
+			continue
+		}
+		if err := refund(bet.Amount); err != nil {
+			return err
+		}
+	}
+
+	var tickets []LotteryTicket
+	if err := tx.Where("group_id = ? AND user_id = ? AND round_id IN (?)", groupID, userID,
+		tx.Model(&LotteryRound{}).Select("id").Where("drawn = ?", false)).Find(&tickets).Error; err != nil {
+		return err
+	}
+	for _, t := range tickets {
+		cost := t.Count * lotteryTicketPrice
+		if err := tx.Model(&LotteryRound{}).Where("id = ?", t.RoundID).Update("pot", gorm.Expr("pot - ?", cost)).Error; err != nil {
+			return err
+		}
+		if err := refund(cost); err != nil {
+			return err
+		}
+	}
+
+	var entries []TournamentEntry
+	if err := tx.Where("group_id = ? AND user_id = ? AND tournament_id IN (?)", groupID, userID,
+		tx.Model(&Tournament{}).Select("id").Where("ended = ?", false)).Find(&entries).Error; err != nil {
+		return err
+	}
+	for _, e := range entries {
+		var t Tournament
+		if err := tx.First(&t, e.TournamentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&t).Update("pool", t.Pool-t.EntryFee).Error; err != nil {
+			return err
+		}
+		if err := refund(t.EntryFee); err != nil {
+			return err
+		}
+	}
+
+	for _, model := range []interface{}{&BlackjackGame{}, &HiloGame{}, &RouletteBet{}, &CrashBet{}, &LotteryTicket{}, &TournamentEntry{}} {
+		if err := tx.Where("user_id = ? AND group_id = ?", userID, groupID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResetGroup removes every stat, balance, game and pending announcement in a
+// group.
+func (db *DB) ResetGroup(tx *gorm.DB, groupID int64, now time.Time) error {
+	if err := db.resetBalances(tx, now, "group_id = ?", groupID); err != nil {
+		return err
+	}
+	for _, model := range []interface{}{&SlotMachineStats{}, &DiceGameStats{}, &PendingDuel{}, &JackpotPool{}, &DailyClaim{}, &Treasury{}, &BlackjackGame{}, &RouletteRound{}, &RouletteBet{}, &LotteryRound{}, &LotteryTicket{}, &HiloGame{}, &QuickGameStats{}, &CrashChain{}, &CrashRound{}, &CrashBet{}, &Tournament{}, &TournamentEntry{}, &Season{}, &SeasonStats{}, &SeasonDiceStats{}} {
+		if err := tx.Where("group_id = ?", groupID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Where("chat_id = ?", groupID).Delete(&ScheduledMessage{}).Error
+}
+
+func (db *DB) CreateAdminAction(tx *gorm.DB, action *AdminAction) error {
+	return tx.Create(action).Error
+}
+
+// resetBalances zeroes the balances matching the query in the ledger and
+// then deletes them.
+func (db *DB) resetBalances(tx *gorm.DB, now time.Time, query string, args ...interface{}) error {
+	var balances []Balance
+	if err := tx.Where(query, args...).Find(&balances).Error; err != nil {
+		return err
+	}
+	for _, b := range balances {
+		if b.Amount == 0 {
+			continue
+		}
+		if err := tx.Create(&LedgerEntry{
+			UserID:    b.UserID,
+			GroupID:   b.GroupID,
+			Delta:     -b.Amount,
+			Reason:    ledgerAdminReset,
+			CreatedAt: now,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Where(query, args...).Delete(&Balance{}).Error
+}
+
+// GetLedgerEntries returns a user's most recent ledger entries, newest first.
+func (db *DB) GetLedgerEntries(userID, groupID int64, limit int) ([]LedgerEntry, error) {
+	var results []LedgerEntry
+	err := db.Where("user_id = ? AND group_id = ?", userID, groupID).
+		Order("id DESC").Limit(limit).Find(&results).Error
+	return results, err
+}
+
+// CheckLedger recomputes every balance in a group from the ledger and
+// returns the ones that disagree. A missing balance counts as zero.
+func (db *DB) CheckLedger(groupID int64) ([]LedgerMismatch, error) {
+	var mismatches []LedgerMismatch
+	err := db.Raw(`
+		SELECT u.user_id, COALESCE(b.amount, 0) AS balance, COALESCE(l.total, 0) AS ledger
+		FROM (
+			SELECT user_id FROM balances WHERE group_id = ?
+			UNION SELECT user_id FROM ledger_entries WHERE group_id = ?
+		) u
+		LEFT JOIN balances b ON b.user_id = u.user_id AND b.group_id = ?
+		LEFT JOIN (
+			SELECT user_id, SUM(delta) AS total FROM ledger_entries WHERE group_id = ? GROUP BY user_id
+		) l ON l.user_id = u.user_id
+		WHERE COALESCE(b.amount, 0) != COALESCE(l.total, 0)
+		ORDER BY u.user_id`, groupID, groupID, groupID, groupID).Scan(&mismatches).Error
+	return mismatches, err
+}
+
+// backfillLedger records an opening entry for balances that predate the
+// ledger so they reconcile with it.
+func (db *DB) backfillLedger(now time.Time) error {
+	return db.Exec(`
+		INSERT INTO ledger_entries (user_id, group_id, delta, reason, message_id, created_at)
+		SELECT b.user_id, b.group_id, b.amount, ?, 0, ?
+		FROM balances b
+		WHERE b.amount != 0 AND NOT EXISTS (
+			SELECT 1 FROM ledger_entries l WHERE l.user_id = b.user_id AND l.group_id = b.group_id
+		)`, ledgerOpeningBalance, now).Error
+}
+
+// GetUsername returns the username recorded with a player's slot or dice
+// game stats, falling back to User_<id> for players without one.
+func (db *DB) GetUsername(userID, groupID int64) string {
+	var u SlotMachineStats
+	if err := db.Where("user_id = ? AND group_id = ?", userID, groupID).First(&u).Error; err == nil && u.Username != "" {
+		return u.Username
+	}
+	var s DiceGameStats
+	if err := db.Where("user_id = ? AND group_id = ? AND username != ?", userID, groupID, "").First(&s).Error; err == nil {
+		return s.Username
+	}
+	return fmt.Sprintf("User_%d", userID)
 }
@@ -0,0 +1,733 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+// Per-player limits on open challenges within a group
+const (
+	maxOutgoingDuels = 1
+	maxIncomingDuels = 3
+)
+
+// duelAnimationDelay is how long the 🎲 animation plays before the result is
+// announced
+const duelAnimationDelay = 5 * time.Second
+
+var (
+	errTooManyOutgoingDuels = errors.New("too many outgoing duels")
+	errTooManyIncomingDuels = errors.New("too many incoming duels")
+)
+
+func (c *casinoController) duelHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+	initiatorID := update.Message.From.ID
+	initiatorName := update.Message.From.Username
+
+	// Parse target username and stake
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/duel"))
+	if len(args) != 2 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Usage: /duel <username> <amount|all>",
+		})
+		return
+	}
+
+	targetUsername := strings.TrimPrefix(args[0], "@")
+
+	var stake int64
+	allIn := strings.EqualFold(args[1], "all")
+	if !allIn {
+		var err error
+		stake, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil || stake <= 0 {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: groupID,
+				Text:   "The stake must be a positive amount or \"all\".",
+			})
+			return
+		}
+	}
+
+	target, err := c.db.FindUserByUsername(groupID, targetUsername)
+	if err == gorm.ErrRecordNotFound {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "User not found.",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error finding user: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error finding user.",
+		})
+		return
+	}
+	targetID := target.UserID
+
+	var targetBalance int64
+	balance, err := c.db.GetBalance(c.db.DB, targetID, groupID)
+	if err == nil {
+		targetBalance = balance.Amount
+	} else if err != gorm.ErrRecordNotFound {
+		log.Printf("error getting target balance: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting balances.",
+		})
+		return
+	}
+
+	if targetBalance <= 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "The target is too poor to be challenged",
+		})
+		return
+	}
+
+	if targetID == initiatorID {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "You cannot duel yourself!",
+		})
+		return
+	}
+
+	initiatorBalance, err := c.db.GetOrCreateBalance(initiatorID, groupID)
+	if err != nil {
+		log.Printf("error getting initiator balance: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting balances.",
+		})
+		return
+	}
+
+	// Both sides must be able to cover a fixed stake
+	if !allIn && initiatorBalance.Amount < stake {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   fmt.Sprintf("You can't cover a %d$ stake (you have %d$).", stake, initiatorBalance.Amount),
+		})
+		return
+	}
+	if !allIn && targetBalance < stake {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   fmt.Sprintf("@%s can't cover a %d$ stake.", targetUsername, stake),
+		})
+		return
+	}
+
+	duel := &PendingDuel{
+		InitiatorID:   initiatorID,
+		TargetID:      targetID,
+		GroupID:       groupID,
+		TargetName:    targetUsername,
+		InitiatorName: initiatorName,
+		Stake:         stake,
+		AllIn:         allIn,
+		ExpiresAt:     c.clock.Now().Add(10 * time.Minute),
+	}
+
+	// Check both players' open challenges against the limits
+	c.pendingDuelsMu.Lock()
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		outgoing, err := c.db.GetOutgoingDuels(tx, groupID, initiatorID, c.clock.Now())
+		if err != nil {
+			return err
+		}
+		if len(outgoing) >= maxOutgoingDuels {
+			return errTooManyOutgoingDuels
+		}
+
+		incoming, err := c.db.GetIncomingDuels(tx, groupID, targetID, c.clock.Now())
+		if err != nil {
+			return err
+		}
+		if len(incoming) >= maxIncomingDuels {
+			return errTooManyIncomingDuels
+		}
+
+		// Store pending duel
+		return c.db.CreatePendingDuel(tx, duel)
+	})
+	c.pendingDuelsMu.Unlock()
+
+	if err == errTooManyOutgoingDuels {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "You already have a pending challenge. Type /cancelDuel to withdraw it.",
+		})
+		return
+	}
+	if err == errTooManyIncomingDuels {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   fmt.Sprintf("@%s already has too many pending challenges.", targetUsername),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error creating duel: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error creating duel.",
+		})
+		return
+	}
+
+	challengeMsg, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text: fmt.Sprintf("Duel #%d: @%s (%d$) has challenged @%s (%d$) to %s!\n\nRules: 🎲 Even = @%s wins, Odd = @%s wins\n\n@%s, tap Accept or Decline below, or type /acceptDuel %d or /declineDuel %d.",
+			duel.ID, initiatorName, initiatorBalance.Amount, targetUsername, targetBalance, duelStakeText(duel),
+			initiatorName, targetUsername, targetUsername, duel.ID, duel.ID),
+		ReplyMarkup: duelKeyboard(duel.ID),
+	})
+	if err != nil {
+		log.Printf("error sending duel challenge: %v", err)
+		return
+	}
+
+	// Remember the challenge so its buttons can be replaced with the outcome
+	if err := c.db.SetDuelMessageID(c.db.DB, duel.ID, challengeMsg.ID); err != nil {
+		log.Printf("error saving duel message: %v", err)
+	}
+}
+
+func (c *casinoController) acceptDuelHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+	targetID := update.Message.From.ID
+	messageID := update.Message.ID
+
+	pendingDuel, reply := c.findDuel(groupID, targetID, update.Message.Text, "/acceptDuel", true)
+	if pendingDuel == nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          groupID,
+			Text:            reply,
+			ReplyParameters: &models.ReplyParameters{MessageID: messageID},
+		})
+		return
+	}
+
+	c.playDuel(ctx, b, pendingDuel, messageID)
+}
+
+// playDuel escrows both stakes, rolls the dice and settles the duel, leaving
+// the result announcement to the scheduler so the dice animation can finish
+// without holding up the worker. Error replies quote replyTo unless it is
+// zero, as for button presses.
+func (c *casinoController) playDuel(ctx context.Context, b BotInterface, pendingDuel *PendingDuel, replyTo int) {
+	c.pendingDuelsMu.Lock()
+	reply, outcome := c.escrowDuel(pendingDuel)
+	c.pendingDuelsMu.Unlock()
+
+	if reply != "" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          pendingDuel.GroupID,
+			Text:            reply,
+			ReplyParameters: replyParameters(replyTo),
+		})
+		if outcome != "" {
+			c.closeDuelMessage(ctx, b, pendingDuel, outcome)
+		}
+		return
+	}
+
+	// The duel is accepted now, so nothing else touches it until it settles
+	groupID := pendingDuel.GroupID
+
+	// Send dice roll
+	diceMsg, err := b.SendDice(ctx, &bot.SendDiceParams{
+		ChatID: groupID,
+		Emoji:  "🎲",
+	})
+	if err != nil || diceMsg.Dice == nil {
+		log.Printf("error sending dice: %v", err)
+		if err := c.db.Transaction(func(tx *gorm.DB) error {
+			return c.db.RefundDuel(tx, pendingDuel, c.clock.Now())
+		}); err != nil {
+			log.Printf("error refunding duel: %v", err)
+		}
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          groupID,
+			Text:            "Error sending dice roll. Stakes have been refunded.",
+			ReplyParameters: replyParameters(replyTo),
+		})
+		c.closeDuelMessage(ctx, b, pendingDuel, "The dice roll failed, stakes were refunded.")
+		return
+	}
+
+	// Pay the whole pot to the winner and queue the announcement for when the
+	// dice animation has played out
+	if _, err := c.playGame(ctx, b, c.duels, Play{
+		UserID:  pendingDuel.InitiatorID,
+		GroupID: groupID,
+		Value:   diceMsg.Dice.Value,
+		Ref:     pendingDuel.ID,
+	}); err != nil {
+		log.Printf("error settling duel: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          groupID,
+			Text:            "Error transferring balance.",
+			ReplyParameters: replyParameters(replyTo),
+		})
+	}
+}
+
+// escrowDuel re-checks that the duel is still open, validates both balances
+// against the stake and moves the stakes into escrow. It must be called with
+// pendingDuelsMu held and makes no network calls. When the duel can't go ahead
+// it returns the reply to send and, if the duel was called off, the outcome
+// for the challenge message.
+func (c *casinoController) escrowDuel(pendingDuel *PendingDuel) (reply, outcome string) {
+	groupID := pendingDuel.GroupID
+
+	current, err := c.db.GetPendingDuel(c.db.DB, pendingDuel.ID)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		log.Printf("error getting pending duel: %v", err)
+		return "Error getting pending duel.", ""
+	}
+	if err == gorm.ErrRecordNotFound || current.Accepted || c.clock.Now().After(current.ExpiresAt) {
+		return "This duel is no longer open.", ""
+	}
+	*pendingDuel = *current
+
+	// Get balances
+	initiatorBalance, err := c.db.GetOrCreateBalance(pendingDuel.InitiatorID, groupID)
+	if err != nil {
+		log.Printf("error getting initiator balance: %v", err)
+		return "Error getting balances.", ""
+	}
+
+	targetBalance, err := c.db.GetOrCreateBalance(pendingDuel.TargetID, groupID)
+	if err != nil {
+		log.Printf("error getting target balance: %v", err)
+		return "Error getting balances.", ""
+	}
+
+	// All-in duels put each player's whole balance on the line
+	initiatorStake, targetStake := pendingDuel.Stake, pendingDuel.Stake
+	if pendingDuel.AllIn {
+		initiatorStake, targetStake = initiatorBalance.Amount, targetBalance.Amount
+	}
+
+	if pendingDuel.AllIn && initiatorStake <= 0 && targetStake <= 0 {
+		if err := c.db.DeletePendingDuel(c.db.DB, pendingDuel.ID); err != nil {
+			log.Printf("error deleting pending duel: %v", err)
+		}
+		return "Both players have no balance to duel for!", "Both players were broke, the duel is off."
+	}
+
+	if !pendingDuel.AllIn && (initiatorBalance.Amount < pendingDuel.Stake || targetBalance.Amount < pendingDuel.Stake) {
+		if err := c.db.DeletePendingDuel(c.db.DB, pendingDuel.ID); err != nil {
+			log.Printf("error deleting pending duel: %v", err)
+		}
+		return fmt.Sprintf("Someone can no longer cover the %d$ stake. The duel is off.", pendingDuel.Stake),
+			"The stake could no longer be covered, the duel is off."
+	}
+
+	// Escrow both stakes before rolling so they can't be spent mid-duel
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		return c.db.EscrowDuelStakes(tx, pendingDuel, initiatorStake, targetStake, c.clock.Now())
+	}); err != nil {
+		log.Printf("error escrowing stakes: %v", err)
+		return "Error escrowing stakes.", ""
+	}
+
+	return "", ""
+}
+
+func (c *casinoController) declineDuelHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+	targetID := update.Message.From.ID
+
+	c.pendingDuelsMu.Lock()
+	pendingDuel, reply := c.findDuel(groupID, targetID, update.Message.Text, "/declineDuel", true)
+	if pendingDuel != nil {
+		if err := c.db.DeletePendingDuel(c.db.DB, pendingDuel.ID); err != nil {
+			log.Printf("error deleting pending duel: %v", err)
+			pendingDuel, reply = nil, "Error removing duel."
+		}
+	}
+	c.pendingDuelsMu.Unlock()
+
+	if pendingDuel == nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   reply,
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   fmt.Sprintf("@%s chickened out of the duel!", pendingDuel.TargetName),
+	})
+	c.closeDuelMessage(ctx, b, pendingDuel, fmt.Sprintf("@%s chickened out.", pendingDuel.TargetName))
+}
+
+func (c *casinoController) cancelDuelHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+	initiatorID := update.Message.From.ID
+
+	c.pendingDuelsMu.Lock()
+	pendingDuel, reply := c.findDuel(groupID, initiatorID, update.Message.Text, "/cancelDuel", false)
+	if pendingDuel != nil {
+		if err := c.db.DeletePendingDuel(c.db.DB, pendingDuel.ID); err != nil {
+			log.Printf("error deleting pending duel: %v", err)
+			pendingDuel, reply = nil, "Error removing duel."
+		}
+	}
+	c.pendingDuelsMu.Unlock()
+
+	if pendingDuel == nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   reply,
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   fmt.Sprintf("Duel against @%s has been cancelled.", pendingDuel.TargetName),
+	})
+	c.closeDuelMessage(ctx, b, pendingDuel, fmt.Sprintf("Cancelled by @%s.", pendingDuel.InitiatorName))
+}
+
+// duelCallbackHandler handles the Accept/Decline/Cancel buttons under a
+// challenge. Callback data has the form "duel:<action>:<id>".
+func (c *casinoController) duelCallbackHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	query := update.CallbackQuery
+	if query == nil {
+		return
+	}
+
+	answer := func(text string) {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            text,
+			ShowAlert:       text != "",
+		}); err != nil {
+			log.Printf("error answering callback query: %v", err)
+		}
+	}
+
+	parts := strings.Split(query.Data, ":")
+	if len(parts) != 3 {
+		answer("")
+		return
+	}
+	action := parts[1]
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		answer("")
+		return
+	}
+
+	c.pendingDuelsMu.Lock()
+	pendingDuel, alert := c.authorizeDuelButton(query, action, uint(id))
+	if pendingDuel != nil && action != "accept" {
+		if err := c.db.DeletePendingDuel(c.db.DB, pendingDuel.ID); err != nil {
+			log.Printf("error deleting pending duel: %v", err)
+			pendingDuel, alert = nil, "Error removing duel."
+		}
+	}
+	c.pendingDuelsMu.Unlock()
+
+	answer(alert)
+	if pendingDuel == nil {
+		return
+	}
+
+	switch action {
+	case "accept":
+		c.playDuel(ctx, b, pendingDuel, 0)
+	case "decline":
+		c.closeDuelMessage(ctx, b, pendingDuel, fmt.Sprintf("@%s chickened out.", pendingDuel.TargetName))
+	case "cancel":
+		c.closeDuelMessage(ctx, b, pendingDuel, fmt.Sprintf("Cancelled by @%s.", pendingDuel.InitiatorName))
+	}
+}
+
+// authorizeDuelButton loads the duel a button refers to and checks the presser
+// may use it: only the target may accept or decline, only the initiator may
+// cancel. It returns nil and the alert to show when the press is rejected.
+func (c *casinoController) authorizeDuelButton(query *models.CallbackQuery, action string, id uint) (*PendingDuel, string) {
+	pendingDuel, err := c.db.GetPendingDuel(c.db.DB, id)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		log.Printf("error getting pending duel: %v", err)
+		return nil, "Error getting pending duel."
+	}
+	if err == gorm.ErrRecordNotFound || pendingDuel.Accepted || c.clock.Now().After(pendingDuel.ExpiresAt) {
+		return nil, "This duel is no longer open."
+	}
+	if msg := query.Message.Message; msg != nil && msg.Chat.ID != pendingDuel.GroupID {
+		return nil, "This duel is no longer open."
+	}
+
+	switch action {
+	case "accept", "decline":
+		if query.From.ID != pendingDuel.TargetID {
+			return nil, "This duel is not for you!"
+		}
+	case "cancel":
+		if query.From.ID != pendingDuel.InitiatorID {
+			return nil, fmt.Sprintf("Only @%s can cancel this duel.", pendingDuel.InitiatorName)
+		}
+	default:
+		return nil, ""
+	}
+	return pendingDuel, ""
+}
+
+// findDuel resolves which of the sender's open duels a /acceptDuel,
+// /declineDuel or /cancelDuel command refers to: incoming challenges when
+// incoming is set, the sender's own otherwise. An ID after the command picks
+// that duel; without one the sender must have exactly one candidate. When no
+// duel is found, the returned text tells the sender why.
+func (c *casinoController) findDuel(groupID, userID int64, text, command string, incoming bool) (*PendingDuel, string) {
+	var duels []PendingDuel
+	var err error
+	if incoming {
+		duels, err = c.db.GetIncomingDuels(c.db.DB, groupID, userID, c.clock.Now())
+	} else {
+		duels, err = c.db.GetOutgoingDuels(c.db.DB, groupID, userID, c.clock.Now())
+	}
+	if err != nil {
+		log.Printf("error getting pending duels: %v", err)
+		return nil, "Error getting pending duel."
+	}
+
+	if args := strings.TrimSpace(strings.TrimPrefix(text, command)); args != "" {
+		id, err := strconv.ParseUint(strings.TrimPrefix(args, "#"), 10, 64)
+		if err != nil {
+			return nil, fmt.Sprintf("Usage: %s [id]", command)
+		}
+		for i := range duels {
+			if duels[i].ID == uint(id) {
+				return &duels[i], ""
+			}
+		}
+		return nil, fmt.Sprintf("You have no pending duel #%d.", id)
+	}
+
+	switch len(duels) {
+	case 0:
+		return nil, "You have no pending duels."
+	case 1:
+		return &duels[0], ""
+	}
+
+	msg := "You have several pending duels, pick one by ID:"
+	for _, d := range duels {
+		opponent := d.TargetName
+		if incoming {
+			opponent = d.InitiatorName
+		}
+		msg += fmt.Sprintf("\n%s %d - @%s, %s", command, d.ID, opponent, duelStakeText(&d))
+	}
+	return nil, msg
+}
+
+// closeDuelMessage replaces a challenge's text and buttons with its outcome.
+func (c *casinoController) closeDuelMessage(ctx context.Context, b BotInterface, duel *PendingDuel, outcome string) {
+	if duel.MessageID == 0 {
+		return
+	}
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    duel.GroupID,
+		MessageID: duel.MessageID,
+		Text:      duelOutcomeText(duel, outcome),
+	}); err != nil {
+		log.Printf("error editing duel message: %v", err)
+	}
+}
+
+// expireDuels removes challenges nobody answered before ExpiresAt and tells
+// the group.
+func (c *casinoController) expireDuels(ctx context.Context, b BotInterface) {
+	expired, err := c.db.GetExpiredDuels(c.clock.Now())
+	if err != nil {
+		log.Printf("error getting expired duels: %v", err)
+		return
+	}
+
+	for i := range expired {
+		duel := &expired[i]
+		// The target may be accepting the duel through a handler holding
+		// the group's lock
+		lock := c.groupLock(duel.GroupID)
+		lock.Lock()
+		c.pendingDuelsMu.Lock()
+		removed, err := c.db.ExpireDuel(duel.ID, c.clock.Now())
+		c.pendingDuelsMu.Unlock()
+		lock.Unlock()
+		if err != nil {
+			log.Printf("error expiring duel: %v", err)
+			continue
+		}
+		if !removed {
+			continue
+		}
+
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: duel.GroupID,
+			Text:   fmt.Sprintf("⌛ @%s did not respond in time. Duel #%d against @%s has expired.", duel.TargetName, duel.ID, duel.InitiatorName),
+		})
+		c.closeDuelMessage(ctx, b, duel, fmt.Sprintf("Expired, @%s did not respond in time.", duel.TargetName))
+	}
+}
+
+// refundInterruptedDuels returns escrowed stakes of duels that were accepted
+// but never settled because the bot went down mid-roll.
+func (c *casinoController) refundInterruptedDuels(ctx context.Context, b BotInterface) {
+	// Duels accepted but never settled still hold both stakes in escrow
+	interrupted, err := c.db.GetAcceptedDuels()
+	if err != nil {
+		log.Printf("error getting accepted duels: %v", err)
+		return
+	}
+
+	for i := range interrupted {
+		duel := &interrupted[i]
+		if err := c.db.Transaction(func(tx *gorm.DB) error {
+			return c.db.RefundDuel(tx, duel, c.clock.Now())
+		}); err != nil {
+			log.Printf("error refunding duel: %v", err)
+			continue
+		}
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: duel.GroupID,
+			Text:   fmt.Sprintf("The duel between @%s and @%s was interrupted. Stakes have been refunded.", duel.InitiatorName, duel.TargetName),
+		})
+		c.closeDuelMessage(ctx, b, duel, "Interrupted, stakes were refunded.")
+	}
+}
+
+func duelOutcomeText(duel *PendingDuel, outcome string) string {
+	return fmt.Sprintf("Duel #%d: @%s challenged @%s to %s.\n\n%s",
+		duel.ID, duel.InitiatorName, duel.TargetName, duelStakeText(duel), outcome)
+}
+
+func duelStakeText(d *PendingDuel) string {
+	if d.AllIn {
+		return "an all-in duel"
+	}
+	return fmt.Sprintf("a %d$ duel", d.Stake)
+}
+
+func duelKeyboard(id uint) *models.InlineKeyboardMarkup {
+	return &models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{{
+			{Text: "✅ Accept", CallbackData: fmt.Sprintf("duel:accept:%d", id)},
+			{Text: "🐔 Decline", CallbackData: fmt.Sprintf("duel:decline:%d", id)},
+			{Text: "🚫 Cancel", CallbackData: fmt.Sprintf("duel:cancel:%d", id)},
+		}},
+	}
+}
+
+func replyParameters(messageID int) *models.ReplyParameters {
+	if messageID == 0 {
+		return nil
+	}
+	return &models.ReplyParameters{MessageID: messageID}
+}
+
+// duelGame settles accepted duels on the bot's 🎲: even means the initiator
+// wins, odd the target. Duels are started by /acceptDuel and its button, so
+// Parse never matches and playDuel builds the play after rolling.
+type duelGame struct {
+	db *DB
+}
+
+func newDuelGame(db *DB) *duelGame {
+	return &duelGame{db: db}
+}
+
+func (g *duelGame) Parse(update *models.Update) (Play, bool) {
+	return Play{}, false
+}
+
+// Resolve pays the escrowed pot of duel play.Ref to the winner and removes
+// the duel
+func (g *duelGame) Resolve(tx *gorm.DB, play Play) (Outcome, error) {
+	duel, err := g.db.GetPendingDuel(tx, play.Ref)
+	if err != nil {
+		return Outcome{}, err
+	}
+
+	winnerID, winnerName := duel.TargetID, duel.TargetName
+	loserName, amountWon := duel.InitiatorName, duel.InitiatorEscrow
+	resultType := "odd"
+	if play.Value%2 == 0 {
+		winnerID, winnerName = duel.InitiatorID, duel.InitiatorName
+		loserName, amountWon = duel.TargetName, duel.TargetEscrow
+		resultType = "even"
+	}
+
+	if err := g.db.DeletePendingDuel(tx, duel.ID); err != nil {
+		return Outcome{}, err
+	}
+
+	announceAt := play.At.Add(duelAnimationDelay)
+	outcome := Outcome{
+		Ledger: []LedgerEntry{duel.ledgerEntry(winnerID, duel.InitiatorEscrow+duel.TargetEscrow, ledgerDuelWin, play.At)},
+		Messages: []ScheduledMessage{{
+			ChatID: duel.GroupID,
+			Text: fmt.Sprintf("🎲 %d (%s)!\n\n@%s wins %d$ from @%s!",
+				play.Value, resultType, winnerName, amountWon, loserName),
+			SendAt:     announceAt,
+			UserID:     duel.InitiatorID,
+			OpponentID: duel.TargetID,
+		}},
+		Won: true,
+	}
+	if duel.MessageID != 0 {
+		outcome.Messages = append(outcome.Messages, ScheduledMessage{
+			ChatID:        duel.GroupID,
+			EditMessageID: duel.MessageID,
+			Text:          duelOutcomeText(duel, fmt.Sprintf("@%s won %d$ from @%s.", winnerName, amountWon, loserName)),
+			SendAt:        announceAt,
+			UserID:        duel.InitiatorID,
+			OpponentID:    duel.TargetID,
+		})
+	}
+	return outcome, nil
+}
+
+// SaveStats does nothing, duels have no stats of their own
+func (g *duelGame) SaveStats(tx *gorm.DB, play Play, delta StatsDelta) error {
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+// defaultClientSeed is a group's client seed until a player sets one
+const defaultClientSeed = "casino"
+
+const seedUsage = "Usage: /seed to see the current seeds, or /seed <text> to set a new client seed"
+
+// fairResults recompute a round's outcome from its seed for /verify, keyed
+// by FairRound.Game. They use the same functions the games play with.
+var fairResults = map[string]func(seed, param int64) string{
+	"blackjack": func(seed, _ int64) string {
+		return "deck starts " + cardsText(shuffledDeck(seed)[:10])
+	},
+	"hilo": func(seed, _ int64) string {
+		return "deck starts " + cardsText(shuffledDeck(seed)[:10])
+	},
+	"flip": func(seed, _ int64) string {
+		return flipSide(seed)
+	},
+	"roulette": func(seed, _ int64) string {
+		return roulettePocketText(roulettePocket(seed))
+	},
+	"lottery": func(seed, tickets int64) string {
+		return fmt.Sprintf("ticket %d of %d", lotteryPick(seed, tickets)+1, tickets)
+	},
+}
+
+func serverSeedHash(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+// activeServerSeed returns the group's server seed in use, creating the
+// group's first one if needed
+func (c *casinoController) activeServerSeed(tx *gorm.DB, groupID int64) (*ServerSeed, error) {
+	seed, err := c.db.GetActiveServerSeed(tx, groupID)
+	if err == gorm.ErrRecordNotFound {
+		return c.rotateServerSeed(tx, groupID, nil, defaultClientSeed)
+	}
+	return seed, err
+}
+
+// rotateServerSeed retires old, if any, so it can be revealed, and commits
+// to a new server seed paired with clientSeed
+func (c *casinoController) rotateServerSeed(tx *gorm.DB, groupID int64, old *ServerSeed, clientSeed string) (*ServerSeed, error) {
+	if old != nil {
+		old.Active = false
+		if err := c.db.SaveServerSeed(tx, old); err != nil {
+			return nil, err
+		}
+	}
+
+	secret := c.newSecret()
+	seed := &ServerSeed{
+		GroupID:    groupID,
+		Seed:       secret,
+		Hash:       serverSeedHash(secret),
+		ClientSeed: clientSeed,
+		Active:     true,
+	}
+	return seed, c.db.SaveServerSeed(tx, seed)
+}
+
+// fairDraw records a round of game in the group and returns it with the seed
+// the game plays it with. param is whatever else the outcome depends on, such
+// as the number of lottery tickets.
+func (c *casinoController) fairDraw(tx *gorm.DB, groupID int64, game string, param int64) (*FairRound, int64, error) {
+	server, err := c.activeServerSeed(tx, groupID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	round := &FairRound{
+		GroupID:      groupID,
+		Game:         game,
+		ServerSeedID: server.ID,
+		ClientSeed:   server.ClientSeed,
+		Nonce:        server.Nonce,
+		Param:        param,
+		CreatedAt:    c.clock.Now(),
+	}
+	server.Nonce++
+	if err := c.db.SaveServerSeed(tx, server); err != nil {
+		return nil, 0, err
+	}
+	if err := c.db.CreateFairRound(tx, round); err != nil {
+		return nil, 0, err
+	}
+	return round, fairSeed(server.Seed, round.ClientSeed, round.Nonce), nil
+}
+
+// verifyText is how games point players at /verify for a round
+func verifyText(roundID uint) string {
+	return fmt.Sprintf("🔐 /verify %d", roundID)
+}
+
+// seedHandler shows the group's seeds or sets a new client seed. Changing
+// the client seed also replaces the server seed, revealing the old one.
+func (c *casinoController) seedHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+	clientSeed := strings.TrimSpace(strings.TrimPrefix(update.Message.Text, "/seed"))
+	if len(clientSeed) > 64 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   seedUsage,
+		})
+		return
+	}
+
+	var text string
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		seed, err := c.activeServerSeed(tx, groupID)
+		if err != nil {
+			return err
+		}
+		if clientSeed != "" {
+			// Revealing the seed would reveal the decks still being dealt
+			inPlay, err := c.db.ServerSeedInPlay(tx, seed.ID)
+			if err != nil {
+				return err
+			}
+			if inPlay {
+				text = "🔐 A hilo or blackjack game is still dealing from this server seed. Set the client seed once it's over."
+				return nil
+			}
+			old := seed
+			if seed, err = c.rotateServerSeed(tx, groupID, old, clientSeed); err != nil {
+				return err
+			}
+			text = fmt.Sprintf("🔐 @%s set the client seed.\nRetired server seed: %s\n", update.Message.From.Username, old.Seed)
+		}
+
+		text += fmt.Sprintf("🔐 Server seed hash: %s\nClient seed: %s\nNext nonce: %d", seed.Hash, seed.ClientSeed, seed.Nonce)
+		return nil
+	})
+	if err != nil {
+		log.Printf("error getting seeds: %v", err)
+		text = "Error getting seeds."
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   text,
+	})
+}
+
+// verifyHandler reveals the server seed behind a round and recomputes its
+// outcome. A seed still in use is replaced first so revealing it can't
+// give away later rounds.
+func (c *casinoController) verifyHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+	id, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(update.Message.Text, "/verify")), 10, 64)
+	if err != nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Usage: /verify <round>",
+		})
+		return
+	}
+
+	var text string
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		round, err := c.db.GetFairRound(tx, groupID, uint(id))
+		if err == gorm.ErrRecordNotFound {
+			text = fmt.Sprintf("There is no round #%d.", id)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Every game in the group draws from the same server seed, so
+		// revealing it would reveal the decks still being dealt
+		inPlay, err := c.db.ServerSeedInPlay(tx, round.ServerSeedID)
+		if err != nil {
+			return err
+		}
+		if inPlay {
+			text = fmt.Sprintf("A hilo or blackjack game is still dealing from round #%d's server seed. Verify it once that game is over.", round.ID)
+			return nil
+		}
+		server, err := c.db.GetServerSeed(tx, round.ServerSeedID)
+		if err != nil {
+			return err
+		}
+
+		var next *ServerSeed
+		if server.Active {
+			if next, err = c.rotateServerSeed(tx, groupID, server, server.ClientSeed); err != nil {
+				return err
+			}
+		}
+
+		seed := fairSeed(server.Seed, round.ClientSeed, round.Nonce)
+		text = fmt.Sprintf("🔐 Round #%d (%s)", round.ID, round.Game)
+		text += fmt.Sprintf("\nServer seed: %s", server.Seed)
+		text += fmt.Sprintf("\nServer seed hash: %s", server.Hash)
+		text += fmt.Sprintf("\nClient seed: %s", round.ClientSeed)
+		text += fmt.Sprintf("\nNonce: %d", round.Nonce)
+		text += fmt.Sprintf("\nResult: %s", fairResults[round.Game](seed, round.Param))
+		text += "\nThe SHA-256 of the server seed matches the hash published before the round, and HMAC-SHA256(server seed, \"client seed:nonce\") seeds the result."
+		if next != nil {
+			text += fmt.Sprintf("\nThat server seed was still in use, so it has been replaced. New server seed hash: %s", next.Hash)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("error verifying round: %v", err)
+		text = "Error verifying round."
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   text,
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+const flipUsage = "Usage: /flip <amount> <heads|tails>"
+
+// quickGames names the single-player wager games kept in QuickGameStats,
+// keyed by the name /stats takes
+var quickGames = map[string]string{
+	"flip": "🪙 Coin flip",
+	"hilo": "🃏 Higher or lower",
+}
+
+// flipSide tosses the coin for a seed
+func flipSide(seed int64) string {
+	if seededRand(seed).IntN(2) == 1 {
+		return "tails"
+	}
+	return "heads"
+}
+
+// flipHandler bets on a coin toss that pays double
+func (c *casinoController) flipHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	userID := update.Message.From.ID
+	username := update.Message.From.Username
+	groupID := update.Message.Chat.ID
+
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/flip"))
+	var amount int64
+	if len(args) == 2 && (args[1] == "heads" || args[1] == "tails") {
+		amount, _ = strconv.ParseInt(args[0], 10, 64)
+	}
+	if amount <= 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   flipUsage,
+		})
+		return
+	}
+	call := args[1]
+
+	if _, err := c.db.GetOrCreateStats(userID, groupID, username); err != nil {
+		log.Printf("error getting user: %v", err)
+		return
+	}
+	if _, err := c.db.GetOrCreateBalance(userID, groupID); err != nil {
+		log.Printf("error getting balance: %v", err)
+		return
+	}
+
+	var reply string
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		balance, err := c.db.GetBalance(tx, userID, groupID)
+		if err != nil {
+			return err
+		}
+		if balance.Amount < amount {
+			reply = fmt.Sprintf("@%s, you only have %d$.", username, balance.Amount)
+			return nil
+		}
+
+		round, seed, err := c.fairDraw(tx, groupID, "flip", 0)
+		if err != nil {
+			return err
+		}
+		side := flipSide(seed)
+		var payout, won int64
+		if side == call {
+			won = 1
+			payout = 2 * amount
+			reply = fmt.Sprintf("🪙 %s! @%s wins %d$.", strings.ToUpper(side[:1])+side[1:], username, payout)
+		} else {
+			reply = fmt.Sprintf("🪙 %s. @%s loses %d$.", strings.ToUpper(side[:1])+side[1:], username, amount)
+		}
+		reply += "\n" + verifyText(round.ID)
+
+		for _, entry := range []LedgerEntry{
+			{Delta: -amount, Reason: ledgerFlipBet},
+			{Delta: payout, Reason: ledgerFlipWin},
+		} {
+			entry.UserID = userID
+			entry.GroupID = groupID
+			entry.MessageID = update.Message.ID
+			entry.CreatedAt = c.clock.Now()
+			if err := c.db.UpdateBalance(tx, entry); err != nil {
+				return err
+			}
+		}
+		return c.db.RecordQuickGame(tx, &QuickGameStats{
+			UserID:       userID,
+			GroupID:      groupID,
+			Game:         "flip",
+			Username:     username,
+			Played:       1,
+			Won:          won,
+			Wagered:      amount,
+			Returned:     payout,
+			LastPlayedAt: c.clock.Now(),
+		})
+	})
+	if err != nil {
+		log.Printf("error flipping coin: %v", err)
+		reply = "Error flipping coin."
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          groupID,
+		Text:            reply,
+		ReplyParameters: replyParameters(update.Message.ID),
+	})
+}
+
+// quickGameStatsHandler shows the leaderboard of a game in QuickGameStats,
+// ranked by what players took home over what they wagered
+func (c *casinoController) quickGameStatsHandler(ctx context.Context, b BotInterface, update *models.Update, game string) {
+	groupID := update.Message.Chat.ID
+
+	stats, err := c.db.GetQuickGameStatsByGroup(groupID, game)
+	if err != nil {
+		log.Printf("error getting quick game stats: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting stats.",
+		})
+		return
+	}
+
+	if len(stats) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   fmt.Sprintf("No %s stats yet.", game),
+		})
+		return
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		pi, pj := stats[i].Returned-stats[i].Wagered, stats[j].Returned-stats[j].Wagered
+		if pi != pj {
+			return pi > pj
+		}
+		return stats[i].LastPlayedAt.After(stats[j].LastPlayedAt)
+	})
+
+	msg := fmt.Sprintf("%s leaderboard:", quickGames[game])
+	for i, u := range stats {
+		msg += fmt.Sprintf("\n%d. %s %+d$ (won %d/%d, wagered %d$)",
+			i+1, u.Username, u.Returned-u.Wagered, u.Won, u.Played, u.Wagered)
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   msg,
+	})
+}
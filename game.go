@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+// Game is something players bet on. The controller asks each registered game
+// to Parse incoming updates, and applies the Outcome of resolving a play in a
+// single transaction. Games never talk to Telegram, so they can be tested
+// against a database alone.
+type Game interface {
+	// Parse turns an update into a play of this game, or reports false if the
+	// update isn't one. Games started by commands instead of updates, like
+	// duels, always report false.
+	Parse(update *models.Update) (Play, bool)
+
+	// Resolve works out what a play changes. It may update the game's own
+	// state in tx but leaves stats, balances and messages to the Outcome.
+	Resolve(tx *gorm.DB, play Play) (Outcome, error)
+
+	// SaveStats records the stats delta of a resolved play.
+	SaveStats(tx *gorm.DB, play Play, delta StatsDelta) error
+}
+
+// Play is a single roll in a game
+type Play struct {
+	UserID    int64
+	Username  string
+	GroupID   int64
+	MessageID int       // message the play arrived in, replies quote it
+	Value     int       // dice value
+	Ref       uint      // game-specific reference, such as the duel being rolled for
+	At        time.Time // set by the controller from its clock
+}
+
+// Outcome is everything a play changes
+type Outcome struct {
+	Stats    StatsDelta
+	Ledger   []LedgerEntry
+	Messages []ScheduledMessage // sent later by the scheduler, e.g. once a dice animation ends
+	Reply    string             // sent straight away in reply to the play, if set
+	Won      bool               // winning spins may stay in the chat longer
+	Refused  bool               // the play didn't count, only Reply is sent
+}
+
+// playGame resolves a play and applies its outcome in one transaction, then
+// sends the outcome's reply
+func (c *casinoController) playGame(ctx context.Context, b BotInterface, game Game, play Play) (Outcome, error) {
+	play.At = c.clock.Now()
+
+	if _, err := c.db.GetOrCreateBalance(play.UserID, play.GroupID); err != nil {
+		return Outcome{}, err
+	}
+
+	var outcome Outcome
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		outcome, err = game.Resolve(tx, play)
+		if err != nil || outcome.Refused {
+			return err
+		}
+		if err := game.SaveStats(tx, play, outcome.Stats); err != nil {
+			return err
+		}
+		for _, entry := range outcome.Ledger {
+			if err := c.db.UpdateBalance(tx, entry); err != nil {
+				return err
+			}
+		}
+		for i := range outcome.Messages {
+			if err := c.db.ScheduleMessage(tx, &outcome.Messages[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Outcome{}, err
+	}
+
+	if outcome.Reply != "" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          play.GroupID,
+			Text:            outcome.Reply,
+			ReplyParameters: replyParameters(play.MessageID),
+		})
+	}
+	return outcome, nil
+}
+
+// parseDicePlay builds a play from a dice message with the given emoji
+func parseDicePlay(update *models.Update, emoji string) (Play, bool) {
+	msg := update.Message
+	if msg == nil || msg.Dice == nil || msg.Dice.Emoji != emoji || msg.From == nil {
+		return Play{}, false
+	}
+	return Play{
+		UserID:    msg.From.ID,
+		Username:  msg.From.Username,
+		GroupID:   msg.Chat.ID,
+		MessageID: msg.ID,
+		Value:     msg.Dice.Value,
+	}, true
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+// Telegram rolls these emojis server-side; see the value decoders below for
+// what each value shows
+
+type dartsValue int // 1 misses the board, 6 is a bullseye
+
+func (v dartsValue) bullseye() bool { return v == 6 }
+
+// ring counts rings from the edge, 0 for a miss
+func (v dartsValue) ring() int { return int(v) - 1 }
+
+type basketballValue int // 1-3 miss, 4 and 5 go in
+
+func (v basketballValue) scored() bool { return v >= 4 }
+
+// swish is the clean shot that doesn't touch the rim
+func (v basketballValue) swish() bool { return v == 5 }
+
+type footballValue int // 1 and 2 miss, 3-5 are goals
+
+func (v footballValue) scored() bool { return v >= 3 }
+
+type bowlingValue int // 1 is a gutter ball, 6 a strike
+
+func (v bowlingValue) strike() bool { return v == 6 }
+
+// pins knocked down by the roll
+func (v bowlingValue) pins() int {
+	switch v {
+	case 1:
+		return 0
+	case 2:
+		return 1
+	default:
+		return int(v)
+	}
+}
+
+type diceValue int // 1-6 pips
+
+func (v diceValue) pips() int { return int(v) }
+
+// diceOutcome is how a single roll of a dice game scored
+type diceOutcome struct {
+	Points int64
+	Top    bool // the game's best result, e.g. a bullseye or strike
+}
+
+// diceGame is a game played by sending a Telegram dice emoji, where each
+// roll scores on its own. Rolls are free and only count for the
+// leaderboard, they never pay into the balance.
+type diceGame struct {
+	Emoji    string
+	Name     string // shown on leaderboards
+	TopLabel string // what the top result is called on the leaderboard
+	Score    func(value int) diceOutcome
+
+	db *DB
+}
+
+// diceGameOrder lists diceGames in the fixed order they are tried against
+// incoming dice
+var diceGameOrder = []string{"🎯", "🏀", "⚽", "🎳", "🎲"}
+
+// diceGames maps Dice.Emoji to its game. 🎰 is the slotGame.
+var diceGames = map[string]diceGame{
+	"🎯": {
+		Emoji: "🎯", Name: "darts", TopLabel: "bullseyes",
+		Score: func(value int) diceOutcome {
+			v := dartsValue(value)
+			if v.bullseye() {
+				return diceOutcome{Points: 30, Top: true}
+			}
+			return diceOutcome{Points: []int64{0, 0, 0, 5, 10}[v.ring()]}
+		},
+	},
+	"🏀": {
+		Emoji: "🏀", Name: "basketball", TopLabel: "swishes",
+		Score: func(value int) diceOutcome {
+			v := basketballValue(value)
+			switch {
+			case v.swish():
+				return diceOutcome{Points: 15, Top: true}
+			case v.scored():
+				return diceOutcome{Points: 10}
+			}
+			return diceOutcome{}
+		},
+	},
+	"⚽": {
+		Emoji: "⚽", Name: "football", TopLabel: "goals",
+		Score: func(value int) diceOutcome {
+			if footballValue(value).scored() {
+				return diceOutcome{Points: 5, Top: true}
+			}
+			return diceOutcome{}
+		},
+	},
+	"🎳": {
+		Emoji: "🎳", Name: "bowling", TopLabel: "strikes",
+		Score: func(value int) diceOutcome {
+			v := bowlingValue(value)
+			switch {
+			case v.strike():
+				return diceOutcome{Points: 30, Top: true}
+			case v.pins() == 5:
+				return diceOutcome{Points: 10}
+			}
+			return diceOutcome{}
+		},
+	},
+	"🎲": {
+		Emoji: "🎲", Name: "dice", TopLabel: "sixes",
+		Score: func(value int) diceOutcome {
+			if diceValue(value).pips() == 6 {
+				return diceOutcome{Points: 10, Top: true}
+			}
+			return diceOutcome{}
+		},
+	},
+}
+
+func (g *diceGame) Parse(update *models.Update) (Play, bool) {
+	return parseDicePlay(update, g.Emoji)
+}
+
+func (g *diceGame) Resolve(tx *gorm.DB, play Play) (Outcome, error) {
+	result := g.Score(play.Value)
+	delta := StatsDelta{TotalGames: 1, Score: int(result.Points)}
+	if result.Points > 0 {
+		delta.Wins = 1
+	}
+	if result.Top {
+		delta.TopHits = 1
+	}
+	return Outcome{Stats: delta, Won: result.Points > 0}, nil
+}
+
+func (g *diceGame) SaveStats(tx *gorm.DB, play Play, delta StatsDelta) error {
+	if err := g.db.EnsureDiceGameStats(tx, play.UserID, play.GroupID, g.Emoji, play.Username); err != nil {
+		return err
+	}
+	if err := g.db.UpdateDiceGameStats(tx, play.UserID, play.GroupID, g.Emoji, play.At, delta); err != nil {
+		return err
+	}
+	return g.db.AddSeasonDiceStats(tx, play.UserID, play.GroupID, g.Emoji, play.Username, play.At, delta)
+}
+
+// title is the game's name for leaderboard headers
+func (g *diceGame) title() string {
+	return strings.ToUpper(g.Name[:1]) + g.Name[1:]
+}
+
+// sortDiceGameStats ranks a dice game's players by score, then by who needed
+// fewer rolls, then by who played last
+func sortDiceGameStats(stats []SeasonDiceStats) {
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Score != stats[j].Score {
+			return stats[i].Score > stats[j].Score
+		}
+		if stats[i].TotalGames != stats[j].TotalGames {
+			return stats[i].TotalGames < stats[j].TotalGames
+		}
+		return stats[i].LastPlayedAt.After(stats[j].LastPlayedAt)
+	})
+}
+
+// statsLine renders a player's row of the game's leaderboard
+func (g *diceGame) statsLine(rank int, u *SeasonDiceStats) string {
+	name := u.Username
+	if name == "" {
+		name = fmt.Sprintf("User_%d", u.UserID)
+	}
+	return fmt.Sprintf("%d. %s - %d pts (%s:%d wins:%d %s:%d)",
+		rank, name, u.Score, g.TopLabel, u.TopHits, u.Wins, g.Emoji, u.TotalGames)
+}
+
+// gameStatsHandler shows the leaderboard of a dice game, /stats <emoji>
+func (c *casinoController) gameStatsHandler(ctx context.Context, b BotInterface, update *models.Update, emoji string) {
+	groupID := update.Message.Chat.ID
+
+	if _, ok := quickGames[emoji]; ok {
+		c.quickGameStatsHandler(ctx, b, update, emoji)
+		return
+	}
+
+	game, ok := diceGames[emoji]
+	if !ok {
+		var emojis, names []string
+		for e := range diceGames {
+			emojis = append(emojis, e)
+		}
+		for name := range quickGames {
+			names = append(names, name)
+		}
+		sort.Strings(emojis)
+		sort.Strings(names)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   fmt.Sprintf("Usage: /stats [game], where game is one of 🎰 %s %s", strings.Join(emojis, " "), strings.Join(names, " ")),
+		})
+		return
+	}
+
+	stats, err := c.db.GetRunningSeasonDiceStats(groupID, game.Emoji)
+	if err != nil {
+		log.Printf("error getting dice game stats: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting stats.",
+		})
+		return
+	}
+
+	if len(stats) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   fmt.Sprintf("No %s stats yet.", game.Name),
+		})
+		return
+	}
+
+	sortDiceGameStats(stats)
+
+	msg := fmt.Sprintf("%s %s leaderboard:", game.Emoji, game.title())
+	for i := range stats {
+		msg += "\n" + game.statsLine(i+1, &stats[i])
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   msg,
+	})
+}
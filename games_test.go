@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := OpenDB(filepath.Join(t.TempDir(), "casino.db"))
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	return db
+}
+
+func TestSlotGameResolve(t *testing.T) {
+	tests := []struct {
+		name       string
+		balance    int64
+		bet        int64
+		value      int
+		wantDeltas []int64
+		wantWon    bool
+		refused    bool
+	}{
+		{name: "free losing spin", value: 2},
+		{name: "free sevens", value: 64, wantWon: true},
+		{name: "wagered sevens", balance: 50, bet: 20, value: 64, wantDeltas: []int64{-20, 666, 2}, wantWon: true},
+		{name: "wagered loss", balance: 50, bet: 20, value: 2, wantDeltas: []int64{-20, 0}},
+		{name: "bet not covered", balance: 5, bet: 20, value: 64, refused: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.Create(&Balance{UserID: 1, GroupID: 1, Amount: tt.balance, Bet: tt.bet}).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			outcome, err := newSlotGame(db).Resolve(db.DB, Play{UserID: 1, GroupID: 1, Value: tt.value, At: time.Now()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if outcome.Refused != tt.refused {
+				t.Fatalf("refused = %v, want %v", outcome.Refused, tt.refused)
+			}
+			if outcome.Won != tt.wantWon {
+				t.Errorf("won = %v, want %v", outcome.Won, tt.wantWon)
+			}
+			if len(outcome.Ledger) != len(tt.wantDeltas) {
+				t.Fatalf("got %d ledger entries, want %d", len(outcome.Ledger), len(tt.wantDeltas))
+			}
+			for i, entry := range outcome.Ledger {
+				if entry.Delta != tt.wantDeltas[i] {
+					t.Errorf("ledger entry %d delta = %d, want %d", i, entry.Delta, tt.wantDeltas[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPaytableScore(t *testing.T) {
+	p := defaultPaytable()
+	p["pair-7"] = 5
+	p["7-7-bar"] = 0
+
+	tests := []struct {
+		name  string
+		value int
+		want  int64
+	}{
+		{name: "three sevens", value: 64, want: 100},
+		{name: "pair of sevens", value: 52, want: 5},
+		{name: "exact combo set to zero beats the pair", value: 16, want: 0},
+		{name: "no combo", value: 2, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.score(slotMachineValue(tt.value)); got != tt.want {
+				t.Errorf("score(%d) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiceGamesScore(t *testing.T) {
+	tests := []struct {
+		emoji  string
+		value  int
+		points int64
+		top    bool
+	}{
+		{"🎯", 6, 30, true},
+		{"🎯", 1, 0, false},
+		{"🏀", 5, 15, true},
+		{"🏀", 4, 10, false},
+		{"⚽", 3, 5, true},
+		{"⚽", 2, 0, false},
+		{"🎳", 6, 30, true},
+		{"🎳", 5, 10, false},
+		{"🎲", 6, 10, true},
+		{"🎲", 5, 0, false},
+	}
+
+	for _, tt := range tests {
+		got := diceGames[tt.emoji].Score(tt.value)
+		if got.Points != tt.points || got.Top != tt.top {
+			t.Errorf("%s %d scored %+v, want %d points, top %v", tt.emoji, tt.value, got, tt.points, tt.top)
+		}
+	}
+}
+
+func TestDiceGameOrder(t *testing.T) {
+	if len(diceGameOrder) != len(diceGames) {
+		t.Fatalf("diceGameOrder has %d games, diceGames has %d", len(diceGameOrder), len(diceGames))
+	}
+	for _, emoji := range diceGameOrder {
+		if _, ok := diceGames[emoji]; !ok {
+			t.Errorf("diceGameOrder lists %s, which isn't in diceGames", emoji)
+		}
+	}
+}
+
+func TestDuelGameResolve(t *testing.T) {
+	db := newTestDB(t)
+	duel := &PendingDuel{GroupID: 1, InitiatorID: 1, TargetID: 2, InitiatorEscrow: 30, TargetEscrow: 50, Accepted: true}
+	if err := db.CreatePendingDuel(db.DB, duel); err != nil {
+		t.Fatal(err)
+	}
+
+	// Even rolls go to the initiator, who takes the whole pot
+	outcome, err := newDuelGame(db).Resolve(db.DB, Play{GroupID: 1, Value: 4, Ref: duel.ID, At: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outcome.Ledger) != 1 || outcome.Ledger[0].UserID != 1 || outcome.Ledger[0].Delta != 80 {
+		t.Errorf("ledger = %+v, want 80$ to user 1", outcome.Ledger)
+	}
+	if _, err := db.GetPendingDuel(db.DB, duel.ID); err == nil {
+		t.Error("duel was not removed")
+	}
+}
+
+func TestBlackjackDealerSoft17(t *testing.T) {
+	// A♠ 6♠ is a soft 17 against a standing 10♥ 8♥
+	for _, hitSoft17 := range []bool{false, true} {
+		g := &BlackjackGame{
+			Seed:   1,
+			Drawn:  4,
+			Dealer: []card{0, 5},
+			Hands:  []blackjackHand{{Cards: []card{22, 20}, Bet: 10}},
+		}
+		if total, soft := handTotal(g.Dealer); total != 17 || !soft {
+			t.Fatalf("dealer total = %d soft %v, want soft 17", total, soft)
+		}
+
+		g.playDealer(hitSoft17)
+		if drew := len(g.Dealer) > 2; drew != hitSoft17 {
+			t.Errorf("hitSoft17 %v: dealer drew %s", hitSoft17, cardsText(g.Dealer))
+		}
+	}
+}
+
+func TestHiloMultiplier(t *testing.T) {
+	// 7♠ 8♥ 8♦ 8♣ 8♠: every 8 is gone, so higher is left with the 9s to
+	// kings and lower with the aces to 7s but one
+	dealt := []card{6, 20, 33, 46, 7}
+	tests := []struct {
+		name    string
+		dealt   []card
+		higher  bool
+		winning int64
+		want    int64
+	}{
+		{name: "first guess", dealt: dealt[:1], higher: true, winning: 24, want: 196},
+		{name: "higher late in the deck", dealt: dealt, higher: true, winning: 20, want: 216},
+		{name: "lower late in the deck", dealt: dealt, higher: false, winning: 27, want: 160},
+		{name: "nothing lower than an ace", dealt: []card{0}, higher: false, winning: 0},
+		{name: "sure guess keeps the multiplier", dealt: []card{0, 13, 26, 39}, higher: true, winning: 48, want: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hiloWinningCards(tt.dealt, tt.higher); got != tt.winning {
+				t.Fatalf("winning cards = %d, want %d", got, tt.winning)
+			}
+			if tt.winning == 0 {
+				return
+			}
+			if got := hiloMultiplier(100, tt.dealt, tt.higher); got != tt.want {
+				t.Errorf("multiplier = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouletteMultiplier(t *testing.T) {
+	tests := []struct {
+		bet    string
+		pocket int
+		want   int64
+	}{
+		{"17", 17, 36},
+		{"17", 18, 0},
+		{"0", 0, 36},
+		{"red", 36, 2},
+		{"black", 36, 0},
+		{"black", 0, 0},
+		{"odd", 35, 2},
+		{"even", 0, 0},
+		{"1st", 12, 3},
+		{"2nd", 12, 0},
+		{"3rd", 25, 3},
+	}
+
+	for _, tt := range tests {
+		kind, number, ok := parseRouletteBet(tt.bet)
+		if !ok {
+			t.Fatalf("parseRouletteBet(%q) failed", tt.bet)
+		}
+		if got := rouletteMultiplier(&RouletteBet{Kind: kind, Number: number}, tt.pocket); got != tt.want {
+			t.Errorf("%s on %d pays %dx, want %dx", tt.bet, tt.pocket, got, tt.want)
+		}
+	}
+}
+
+func TestRouletteBetAfterClose(t *testing.T) {
+	db := newTestDB(t)
+	svc := newCasinoController("test-token", "testbot", db)
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	svc.clock = clock
+
+	// The scheduler hasn't spun the round yet
+	if err := db.Create(&RouletteRound{GroupID: 1, ClosesAt: clock.now}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&Balance{UserID: 1, GroupID: 1, Amount: 100}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	runScenario(t, TestScenario{
+		Username: "alice",
+		UserID:   1,
+		Command:  "/roulette 10 red",
+		Expected: "🎡 Bets are closed, the wheel is about to spin.",
+	}, svc)
+
+	balance, err := db.GetBalance(db.DB, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Amount != 100 {
+		t.Errorf("balance = %d, want 100", balance.Amount)
+	}
+}
+
+func TestCrashChain(t *testing.T) {
+	seed := "crash test seed"
+	anchor := crashChainHash(seed, 0)
+	prev := anchor
+	for n := 1; n <= 5; n++ {
+		hash := crashChainHash(seed, n)
+		if crashHash(hash) != prev {
+			t.Fatalf("round %d hash doesn't hash to round %d's", n, n-1)
+		}
+		prev = hash
+
+		round := &CrashRound{StartsAt: time.Unix(0, 0), CrashPoint: crashPoint(hash)}
+		if round.CrashPoint < 100 {
+			t.Errorf("round %d crashes at %d, below 1.00x", n, round.CrashPoint)
+		}
+		// The multiplier reaches the crash point right when the round crashes
+		if got := crashMultiplier(round.crashAt().Add(time.Millisecond).Sub(round.StartsAt)); got < round.CrashPoint {
+			t.Errorf("round %d reached %d at its crash time, want %d", n, got, round.CrashPoint)
+		}
+	}
+}
+
+func TestTournamentPayouts(t *testing.T) {
+	tests := []struct {
+		pool    int64
+		entries int
+		want    []int64
+	}{
+		{100, 5, []int64{50, 30, 20}},
+		{35, 3, []int64{18, 10, 7}},
+		{40, 2, []int64{28, 12}},
+		{10, 1, []int64{10}},
+		{0, 0, []int64{}},
+	}
+
+	for _, tt := range tests {
+		got := tournamentPayouts(tt.pool, tt.entries)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%d$ between %d entries pays %v, want %v", tt.pool, tt.entries, got, tt.want)
+		}
+	}
+}
+
+func TestSeasonStats(t *testing.T) {
+	db := newTestDB(t)
+	svc := newCasinoController("test-token", "testbot", db)
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	svc.clock = clock
+	if err := db.Create(&Balance{UserID: 1, GroupID: 1, Amount: 100}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	spin := func(score int) {
+		t.Helper()
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return newSlotGame(db).SaveStats(tx, Play{UserID: 1, GroupID: 1, Username: "alice", At: clock.now}, StatsDelta{TotalGames: 1, Score: score})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spin(10)
+	mockBot := NewMockBot()
+	mockBot.SetAdmin(9)
+	svc.seasonHandler(context.Background(), mockBot, newScenarioUpdate(TestScenario{Username: "admin", UserID: 9, Command: "/season end"}))
+	if got, want := normalizeResponse(mockBot.GetLastMessage()), "🏁 Season 1 is over!\n🥇 @alice · Season 1 Champion · 10 pts\nThe leaderboards are reset for season 2. Final standings: /stats season:1"; got != want {
+		t.Fatalf("/season end = %q, want %q", got, want)
+	}
+	clock.now = clock.now.Add(time.Hour)
+	spin(5)
+
+	lifetime, err := db.GetOrCreateStats(1, 1, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lifetime.Score != 15 || lifetime.TotalGames != 2 {
+		t.Errorf("lifetime stats = %d pts in %d spins, want 15 pts in 2", lifetime.Score, lifetime.TotalGames)
+	}
+
+	season, err := db.GetSeason(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ended, err := db.GetSeasonStats(db.DB, season.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ended) != 1 || ended[0].Score != 10 || ended[0].Rank != 1 || ended[0].Title != "Season 1 Champion" {
+		t.Errorf("season 1 stats = %+v, want alice ranked first with 10 pts", ended)
+	}
+
+	running, err := db.GetRunningSeasonStats(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(running) != 1 || running[0].Score != 5 || running[0].Rank != 0 {
+		t.Errorf("season 2 stats = %+v, want alice unranked with 5 pts", running)
+	}
+}
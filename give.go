@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+// giveCapWindow is the rolling window GroupSettings.GiveCap applies to
+const giveCapWindow = 24 * time.Hour
+
+const giveUsage = "Usage: /give @username <amount>. Admins: /give cap <amount|none>, /give tax <percent> <burn|treasury>"
+
+// giveHandler transfers balance between players, or shows and changes the
+// group's gift rules
+func (c *casinoController) giveHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/give"))
+
+	settings, err := c.db.GetGroupSettings(groupID)
+	if err != nil {
+		log.Printf("error getting group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting settings.",
+		})
+		return
+	}
+
+	switch {
+	case len(args) == 0:
+		treasury, err := c.db.GetTreasury(c.db.DB, groupID)
+		if err != nil {
+			log.Printf("error getting treasury: %v", err)
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: groupID,
+				Text:   "Error getting treasury.",
+			})
+			return
+		}
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   giveRulesText(settings, treasury),
+		})
+	case args[0] == "cap" || args[0] == "tax":
+		c.setGiveRules(ctx, b, update, settings, args)
+	default:
+		c.give(ctx, b, update, settings)
+	}
+}
+
+// give handles /give @username <amount>
+func (c *casinoController) give(ctx context.Context, b BotInterface, update *models.Update, settings *GroupSettings) {
+	groupID := update.Message.Chat.ID
+	senderID := update.Message.From.ID
+	senderName := update.Message.From.Username
+
+	targetName, amount, ok := parseUserAmount(update.Message.Text, "/give")
+	if !ok || amount <= 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   giveUsage,
+		})
+		return
+	}
+
+	target, err := c.db.FindUserByUsername(groupID, targetName)
+	if err == gorm.ErrRecordNotFound {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "User not found.",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error finding user: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error finding user.",
+		})
+		return
+	}
+
+	if target.UserID == senderID {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "You can't give money to yourself.",
+		})
+		return
+	}
+
+	if _, err := c.db.GetOrCreateBalance(senderID, groupID); err != nil {
+		log.Printf("error getting balance: %v", err)
+		return
+	}
+	if _, err := c.db.GetOrCreateBalance(target.UserID, groupID); err != nil {
+		log.Printf("error getting balance: %v", err)
+		return
+	}
+
+	tax := amount * settings.GiveTax / 100
+	now := c.clock.Now()
+	var reply string
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		balance, err := c.db.GetBalance(tx, senderID, groupID)
+		if err != nil {
+			return err
+		}
+		if balance.Amount < amount {
+			reply = fmt.Sprintf("@%s, you only have %d$.", senderName, balance.Amount)
+			return nil
+		}
+
+		if settings.GiveCap > 0 {
+			given, err := c.db.GetGivenSince(tx, senderID, groupID, now.Add(-giveCapWindow))
+			if err != nil {
+				return err
+			}
+			if given+amount > settings.GiveCap {
+				reply = fmt.Sprintf("@%s, you can give at most %d$ per day and have %d$ left.",
+					senderName, settings.GiveCap, max(settings.GiveCap-given, 0))
+				return nil
+			}
+		}
+
+		entry := LedgerEntry{
+			GroupID:   groupID,
+			Delta:     amount - tax,
+			Reason:    ledgerGift,
+			MessageID: update.Message.ID,
+			CreatedAt: now,
+		}
+		if err := c.db.TransferBalance(tx, senderID, target.UserID, entry); err != nil {
+			return err
+		}
+
+		reply = fmt.Sprintf("🎁 @%s gave @%s %d$.", senderName, targetName, amount-tax)
+		if tax == 0 {
+			return nil
+		}
+
+		entry.UserID, entry.Delta, entry.Reason = senderID, -tax, ledgerGiftTax
+		if err := c.db.UpdateBalance(tx, entry); err != nil {
+			return err
+		}
+		if settings.GiveTaxToTreasury {
+			reply += fmt.Sprintf(" %d$ tax went to the treasury.", tax)
+			return c.db.AddToTreasury(tx, groupID, tax)
+		}
+		reply += fmt.Sprintf(" %d$ tax was burned.", tax)
+		return nil
+	})
+	if err != nil {
+		log.Printf("error giving: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error transferring balance.",
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          groupID,
+		Text:            reply,
+		ReplyParameters: replyParameters(update.Message.ID),
+	})
+}
+
+// setGiveRules handles /give cap and /give tax
+func (c *casinoController) setGiveRules(ctx context.Context, b BotInterface, update *models.Update, settings *GroupSettings, args []string) {
+	groupID := update.Message.Chat.ID
+
+	if !c.requireAdmin(ctx, b, update) {
+		return
+	}
+
+	ok := false
+	switch {
+	case args[0] == "cap" && len(args) == 2 && args[1] == "none":
+		settings.GiveCap, ok = 0, true
+	case args[0] == "cap" && len(args) == 2:
+		giveCap, err := strconv.ParseInt(args[1], 10, 64)
+		settings.GiveCap, ok = giveCap, err == nil && giveCap > 0
+	case args[0] == "tax" && len(args) == 3 && (args[2] == "burn" || args[2] == "treasury"):
+		tax, err := strconv.ParseInt(strings.TrimSuffix(args[1], "%"), 10, 64)
+		settings.GiveTax, ok = tax, err == nil && tax >= 0 && tax <= 100
+		settings.GiveTaxToTreasury = args[2] == "treasury"
+	}
+	if !ok {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   giveUsage,
+		})
+		return
+	}
+
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		if err := c.db.SaveGroupSettings(tx, settings); err != nil {
+			return err
+		}
+		return c.auditAdminAction(tx, update, "give", 0, strings.Join(args, " "))
+	}); err != nil {
+		log.Printf("error saving group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error saving settings.",
+		})
+		return
+	}
+
+	treasury, err := c.db.GetTreasury(c.db.DB, groupID)
+	if err != nil {
+		log.Printf("error getting treasury: %v", err)
+		return
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   giveRulesText(settings, treasury),
+	})
+}
+
+func giveRulesText(settings *GroupSettings, treasury *Treasury) string {
+	limit := "No daily limit"
+	if settings.GiveCap > 0 {
+		limit = fmt.Sprintf("Daily limit: %d$ per player", settings.GiveCap)
+	}
+	tax := "No tax"
+	if settings.GiveTax > 0 {
+		tax = fmt.Sprintf("Tax: %d%%, burned", settings.GiveTax)
+		if settings.GiveTaxToTreasury {
+			tax = fmt.Sprintf("Tax: %d%%, paid to the treasury", settings.GiveTax)
+		}
+	}
+	return fmt.Sprintf("🎁 Gifts\n%s\n%s\nTreasury: %d$", limit, tax, treasury.Amount)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+const hiloUsage = "Usage: /hilo <amount>, then guess whether each card is higher or lower than the last"
+
+// hiloWinningCards returns how many of the cards left in the deck beat the
+// last dealt card for a guess. Aces are low and equal ranks lose.
+func hiloWinningCards(dealt []card, higher bool) int64 {
+	last := dealt[len(dealt)-1].rank()
+	beats := func(c card) bool {
+		if higher {
+			return c.rank() > last
+		}
+		return c.rank() < last
+	}
+
+	var n int64
+	for c := card(0); c < 52; c++ {
+		if beats(c) {
+			n++
+		}
+	}
+	for _, c := range dealt {
+		if beats(c) {
+			n--
+		}
+	}
+	return n
+}
+
+// hiloMultiplier prices a right guess from the cards left in the deck: the
+// fair odds, less a thirteenth for the house. A guess that can't lose keeps
+// the multiplier as it is.
+func hiloMultiplier(m int64, dealt []card, higher bool) int64 {
+	left := int64(52 - len(dealt))
+	return max(m, m*left*12/(hiloWinningCards(dealt, higher)*13))
+}
+
+// hiloMultiplierText prints a multiplier kept in hundredths, e.g. "1.50x"
+func hiloMultiplierText(m int64) string {
+	return fmt.Sprintf("%d.%02dx", m/100, m%100)
+}
+
+func (g *HiloGame) card() card {
+	return g.Cards[len(g.Cards)-1]
+}
+
+// payout is what cashing out returns, stake included
+func (g *HiloGame) payout() int64 {
+	return g.Bet * g.Multiplier / 100
+}
+
+func (g *HiloGame) text() string {
+	return fmt.Sprintf("🃏 @%s's higher or lower · %d$\nCards: %s\nMultiplier: %s",
+		g.Username, g.Bet, cardsText(g.Cards), hiloMultiplierText(g.Multiplier))
+}
+
+func (g *HiloGame) keyboard() *models.InlineKeyboardMarkup {
+	var row []models.InlineKeyboardButton
+	if hiloWinningCards(g.Cards, true) > 0 {
+		row = append(row, models.InlineKeyboardButton{Text: "Higher", CallbackData: fmt.Sprintf("hilo:higher:%d", g.ID)})
+	}
+	if hiloWinningCards(g.Cards, false) > 0 {
+		row = append(row, models.InlineKeyboardButton{Text: "Lower", CallbackData: fmt.Sprintf("hilo:lower:%d", g.ID)})
+	}
+	if len(g.Cards) > 1 {
+		row = append(row, models.InlineKeyboardButton{
+			Text:         fmt.Sprintf("Cash out %d$", g.payout()),
+			CallbackData: fmt.Sprintf("hilo:cashout:%d", g.ID),
+		})
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}
+}
+
+// hiloHandler starts a game of higher or lower
+func (c *casinoController) hiloHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	userID := update.Message.From.ID
+	username := update.Message.From.Username
+	groupID := update.Message.Chat.ID
+
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/hilo"))
+	var bet int64
+	if len(args) == 1 {
+		bet, _ = strconv.ParseInt(args[0], 10, 64)
+	}
+	if bet <= 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   hiloUsage,
+		})
+		return
+	}
+
+	if _, err := c.db.GetOrCreateStats(userID, groupID, username); err != nil {
+		log.Printf("error getting user: %v", err)
+		return
+	}
+	if _, err := c.db.GetOrCreateBalance(userID, groupID); err != nil {
+		log.Printf("error getting balance: %v", err)
+		return
+	}
+
+	game := &HiloGame{
+		GroupID:    groupID,
+		UserID:     userID,
+		Username:   username,
+		Bet:        bet,
+		Multiplier: 100,
+	}
+	var reply string
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := c.db.GetActiveHiloGame(tx, groupID, userID); err != gorm.ErrRecordNotFound {
+			if err == nil {
+				reply = fmt.Sprintf("@%s, finish your current game first.", username)
+			}
+			return err
+		}
+
+		balance, err := c.db.GetBalance(tx, userID, groupID)
+		if err != nil {
+			return err
+		}
+		if balance.Amount < bet {
+			reply = fmt.Sprintf("@%s, you only have %d$.", username, balance.Amount)
+			return nil
+		}
+
+		if err := c.db.UpdateBalance(tx, LedgerEntry{
+			UserID:    userID,
+			GroupID:   groupID,
+			Delta:     -bet,
+			Reason:    ledgerHiloBet,
+			MessageID: update.Message.ID,
+			CreatedAt: c.clock.Now(),
+		}); err != nil {
+			return err
+		}
+
+		fair, seed, err := c.fairDraw(tx, groupID, "hilo", 0)
+		if err != nil {
+			return err
+		}
+		game.FairRoundID = fair.ID
+		game.Seed = seed
+		game.Cards = shuffledDeck(game.Seed)[:1]
+		return c.db.CreateHiloGame(tx, game)
+	})
+	if err != nil {
+		log.Printf("error starting hilo: %v", err)
+		reply = "Error starting higher or lower."
+	}
+	if reply != "" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          groupID,
+			Text:            reply,
+			ReplyParameters: replyParameters(update.Message.ID),
+		})
+		return
+	}
+
+	msg, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          groupID,
+		Text:            game.text(),
+		ReplyMarkup:     game.keyboard(),
+		ReplyParameters: replyParameters(update.Message.ID),
+	})
+	if err != nil {
+		log.Printf("error sending hilo game: %v", err)
+		return
+	}
+	if err := c.db.SetHiloMessageID(c.db.DB, game.ID, msg.ID); err != nil {
+		log.Printf("error saving hilo message: %v", err)
+	}
+}
+
+// hiloCallbackHandler plays the higher, lower and cash out buttons
+func (c *casinoController) hiloCallbackHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	query := update.CallbackQuery
+	if query == nil {
+		return
+	}
+
+	answer := func(text string) {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            text,
+			ShowAlert:       text != "",
+		}); err != nil {
+			log.Printf("error answering callback query: %v", err)
+		}
+	}
+
+	parts := strings.Split(query.Data, ":")
+	if len(parts) != 3 {
+		answer("")
+		return
+	}
+	action := parts[1]
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		answer("")
+		return
+	}
+
+	var game *HiloGame
+	var alert, text string
+	finished := false
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		game, err = c.db.GetHiloGame(tx, uint(id))
+		if err == gorm.ErrRecordNotFound {
+			alert = "This game is over."
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if query.From.ID != game.UserID {
+			alert = fmt.Sprintf("This is @%s's game!", game.Username)
+			return nil
+		}
+
+		var payout int64
+		switch action {
+		case "higher", "lower":
+			higher := action == "higher"
+			if hiloWinningCards(game.Cards, higher) == 0 {
+				alert = "You can't do that now."
+				return nil
+			}
+			prev := game.card()
+			multiplier := hiloMultiplier(game.Multiplier, game.Cards, higher)
+			game.Cards = append(game.Cards, shuffledDeck(game.Seed)[len(game.Cards)])
+			if (higher && game.card().rank() > prev.rank()) || (!higher && game.card().rank() < prev.rank()) {
+				game.Multiplier = multiplier
+				text = game.text()
+				return c.db.SaveHiloGame(tx, game)
+			}
+			text = game.text() + fmt.Sprintf("\nWrong! @%s loses %d$.\n%s", game.Username, game.Bet, verifyText(game.FairRoundID))
+		case "cashout":
+			if len(game.Cards) < 2 {
+				alert = "You can't do that now."
+				return nil
+			}
+			payout = game.payout()
+			text = game.text() + fmt.Sprintf("\n@%s cashes out %d$.\n%s", game.Username, payout, verifyText(game.FairRoundID))
+		default:
+			return nil
+		}
+
+		finished = true
+		if err := c.db.UpdateBalance(tx, LedgerEntry{
+			UserID:    game.UserID,
+			GroupID:   game.GroupID,
+			Delta:     payout,
+			Reason:    ledgerHiloWin,
+			MessageID: game.MessageID,
+			CreatedAt: c.clock.Now(),
+		}); err != nil {
+			return err
+		}
+		var won int64
+		if payout > game.Bet {
+			won = 1
+		}
+		if err := c.db.RecordQuickGame(tx, &QuickGameStats{
+			UserID:       game.UserID,
+			GroupID:      game.GroupID,
+			Game:         "hilo",
+			Username:     game.Username,
+			Played:       1,
+			Won:          won,
+			Wagered:      game.Bet,
+			Returned:     payout,
+			LastPlayedAt: c.clock.Now(),
+		}); err != nil {
+			return err
+		}
+		return c.db.DeleteHiloGame(tx, game.ID)
+	})
+	if err != nil {
+		// The guess was rolled back, so the game keeps its last saved state
+		log.Printf("error playing hilo: %v", err)
+		alert, text = "Error playing higher or lower.", ""
+	}
+	answer(alert)
+	if text == "" {
+		return
+	}
+
+	params := &bot.EditMessageTextParams{
+		ChatID:    game.GroupID,
+		MessageID: game.MessageID,
+		Text:      text,
+	}
+	if !finished {
+		params.ReplyMarkup = game.keyboard()
+	}
+	if _, err := b.EditMessageText(ctx, params); err != nil {
+		log.Printf("error editing hilo game: %v", err)
+	}
+}
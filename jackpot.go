@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+const jackpotUsage = "Usage: /jackpot cut <percent>, the share of every slot bet that feeds the jackpot"
+
+// jackpotHandler shows the group's jackpot and lets admins set its cut
+func (c *casinoController) jackpotHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+
+	settings, err := c.db.GetGroupSettings(groupID)
+	if err != nil {
+		log.Printf("error getting group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting settings.",
+		})
+		return
+	}
+
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/jackpot"))
+	if len(args) == 0 {
+		pool, err := c.db.GetJackpotPool(c.db.DB, groupID)
+		if err != nil {
+			log.Printf("error getting jackpot: %v", err)
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: groupID,
+				Text:   "Error getting jackpot.",
+			})
+			return
+		}
+
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   jackpotText(pool, settings),
+		})
+		return
+	}
+
+	if !c.requireAdmin(ctx, b, update) {
+		return
+	}
+
+	if len(args) != 2 || args[0] != "cut" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   jackpotUsage,
+		})
+		return
+	}
+	cut, err := strconv.ParseInt(strings.TrimSuffix(args[1], "%"), 10, 64)
+	if err != nil || cut < 0 || cut > 100 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   jackpotUsage,
+		})
+		return
+	}
+	settings.JackpotCut = cut
+
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		if err := c.db.SaveGroupSettings(tx, settings); err != nil {
+			return err
+		}
+		return c.auditAdminAction(tx, update, "jackpot", 0, strings.Join(args, " "))
+	}); err != nil {
+		log.Printf("error saving group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error saving settings.",
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   fmt.Sprintf("%d%% of every slot bet now feeds the jackpot.", cut),
+	})
+}
+
+func jackpotText(pool *JackpotPool, settings *GroupSettings) string {
+	msg := fmt.Sprintf("💰 Jackpot: %d$\nHit 7️⃣7️⃣7️⃣ on a wagered spin to win it all. %d%% of every slot bet feeds the pool.",
+		pool.Amount, settings.JackpotCut)
+	if pool.LastWinnerID != 0 {
+		msg += fmt.Sprintf("\nLast won by @%s: %d$ on %s", pool.LastWinner, pool.LastWonAmount, pool.LastWonAt.UTC().Format("2006-01-02 15:04"))
+	}
+	return msg
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	defaultHistoryEntries = 10
+	maxHistoryEntries     = 50
+)
+
+// historyHandler shows the sender's most recent balance changes
+func (c *casinoController) historyHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+	userID := update.Message.From.ID
+
+	limit := defaultHistoryEntries
+	if arg := strings.TrimSpace(strings.TrimPrefix(update.Message.Text, "/history")); arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: groupID,
+				Text:   fmt.Sprintf("Usage: /history [count], at most %d", maxHistoryEntries),
+			})
+			return
+		}
+		limit = min(n, maxHistoryEntries)
+	}
+
+	entries, err := c.db.GetLedgerEntries(userID, groupID, limit)
+	if err != nil {
+		log.Printf("error getting ledger entries: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting history.",
+		})
+		return
+	}
+
+	if len(entries) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "No transactions yet.",
+		})
+		return
+	}
+
+	msg := fmt.Sprintf("📜 @%s's last %d transactions:", update.Message.From.Username, len(entries))
+	for _, e := range entries {
+		msg += fmt.Sprintf("\n%s %+d$ %s", e.CreatedAt.UTC().Format("2006-01-02 15:04"), e.Delta, strings.ReplaceAll(e.Reason, "_", " "))
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   msg,
+	})
+}
+
+// checkLedgerHandler lets admins verify that every balance in the group
+// matches its ledger
+func (c *casinoController) checkLedgerHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+
+	if !c.requireAdmin(ctx, b, update) {
+		return
+	}
+
+	mismatches, err := c.db.CheckLedger(groupID)
+	if err != nil {
+		log.Printf("error checking ledger: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error checking ledger.",
+		})
+		return
+	}
+
+	if len(mismatches) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "✅ Every balance matches the ledger.",
+		})
+		return
+	}
+
+	msg := "⚠️ Balances out of sync with the ledger:"
+	for i, m := range mismatches {
+		msg += fmt.Sprintf("\n%d. %s - balance %d$, ledger %d$", i+1, c.db.GetUsername(m.UserID, groupID), m.Balance, m.Ledger)
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   msg,
+	})
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+// lotteryTicketPrice is what one lottery ticket costs
+const lotteryTicketPrice = 10
+
+const lotteryUsage = "Usage: /lottery buy <tickets>. Admins: /lottery schedule <cron>, e.g. /lottery schedule 0 20 * * 0, or /lottery cut <percent>"
+
+func ticketsText(n int64) string {
+	if n == 1 {
+		return "1 ticket"
+	}
+	return fmt.Sprintf("%d tickets", n)
+}
+
+func lotteryTimeText(t time.Time) string {
+	return t.UTC().Format("Mon 2006-01-02 15:04 UTC")
+}
+
+// lotteryHandler shows the group's lottery, buys tickets or lets admins set
+// when it is drawn and the house's cut
+func (c *casinoController) lotteryHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/lottery"))
+	switch {
+	case len(args) == 0:
+		c.showLottery(ctx, b, update)
+	case len(args) == 2 && args[0] == "buy":
+		c.buyLotteryTickets(ctx, b, update, args[1])
+	case len(args) > 1 && (args[0] == "schedule" || args[0] == "cut"):
+		c.setLotteryRule(ctx, b, update, args)
+	default:
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   lotteryUsage,
+		})
+	}
+}
+
+func (c *casinoController) showLottery(ctx context.Context, b BotInterface, update *models.Update) {
+	userID := update.Message.From.ID
+	groupID := update.Message.Chat.ID
+
+	settings, err := c.db.GetGroupSettings(groupID)
+	if err != nil {
+		log.Printf("error getting group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting settings.",
+		})
+		return
+	}
+
+	round, err := c.db.GetOpenLotteryRound(c.db.DB, groupID)
+	if err == gorm.ErrRecordNotFound {
+		round, err = c.newLotteryRound(groupID, settings)
+	}
+	var tickets []LotteryTicket
+	if err == nil {
+		tickets, err = c.db.GetLotteryTickets(c.db.DB, round.ID)
+	}
+	var last *LotteryRound
+	if err == nil {
+		last, err = c.db.GetLastLotteryDraw(groupID)
+		if err == gorm.ErrRecordNotFound {
+			last, err = nil, nil
+		}
+	}
+	if err != nil {
+		log.Printf("error getting lottery: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting lottery.",
+		})
+		return
+	}
+
+	var total, mine int64
+	for _, t := range tickets {
+		total += t.Count
+		if t.UserID == userID {
+			mine = t.Count
+		}
+	}
+
+	text := "🎟️ Lottery"
+	text += fmt.Sprintf("\nPot: %d$ (%s)", round.Pot, ticketsText(total))
+	text += fmt.Sprintf("\nYour tickets: %d", mine)
+	text += fmt.Sprintf("\nNext draw: %s", lotteryTimeText(round.DrawAt))
+	text += fmt.Sprintf("\nHouse cut: %d%%", settings.LotteryCut)
+	if last != nil {
+		text += fmt.Sprintf("\nLast draw: @%s won %d$", last.WinnerName, last.Payout)
+	}
+	text += fmt.Sprintf("\nTickets cost %d$: /lottery buy <tickets>", lotteryTicketPrice)
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   text,
+	})
+}
+
+// newLotteryRound returns a round, not yet saved, drawn at the group's next
+// scheduled time
+func (c *casinoController) newLotteryRound(groupID int64, settings *GroupSettings) (*LotteryRound, error) {
+	schedule, err := parseCron(settings.LotterySchedule)
+	if err != nil {
+		return nil, err
+	}
+	return &LotteryRound{
+		GroupID: groupID,
+		DrawAt:  schedule.Next(c.clock.Now()),
+	}, nil
+}
+
+func (c *casinoController) buyLotteryTickets(ctx context.Context, b BotInterface, update *models.Update, countArg string) {
+	userID := update.Message.From.ID
+	username := update.Message.From.Username
+	groupID := update.Message.Chat.ID
+
+	count, err := strconv.ParseInt(countArg, 10, 64)
+	if err != nil || count <= 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   lotteryUsage,
+		})
+		return
+	}
+
+	settings, err := c.db.GetGroupSettings(groupID)
+	if err != nil {
+		log.Printf("error getting group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting settings.",
+		})
+		return
+	}
+
+	if _, err := c.db.GetOrCreateStats(userID, groupID, username); err != nil {
+		log.Printf("error getting user: %v", err)
+		return
+	}
+	if _, err := c.db.GetOrCreateBalance(userID, groupID); err != nil {
+		log.Printf("error getting balance: %v", err)
+		return
+	}
+
+	var reply string
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		balance, err := c.db.GetBalance(tx, userID, groupID)
+		if err != nil {
+			return err
+		}
+		if count > balance.Amount/lotteryTicketPrice {
+			reply = fmt.Sprintf("@%s, you only have %d$. Tickets cost %d$ each.", username, balance.Amount, lotteryTicketPrice)
+			return nil
+		}
+		cost := count * lotteryTicketPrice
+
+		round, err := c.db.GetOpenLotteryRound(tx, groupID)
+		if err == gorm.ErrRecordNotFound {
+			round, err = c.newLotteryRound(groupID, settings)
+		}
+		if err != nil {
+			return err
+		}
+		round.Pot += cost
+		if err := c.db.SaveLotteryRound(tx, round); err != nil {
+			return err
+		}
+		if err := c.db.AddLotteryTickets(tx, &LotteryTicket{
+			RoundID:  round.ID,
+			GroupID:  groupID,
+			UserID:   userID,
+			Username: username,
+			Count:    count,
+		}); err != nil {
+			return err
+		}
+
+		if err := c.db.UpdateBalance(tx, LedgerEntry{
+			UserID:    userID,
+			GroupID:   groupID,
+			Delta:     -cost,
+			Reason:    ledgerLotteryTicket,
+			MessageID: update.Message.ID,
+			CreatedAt: c.clock.Now(),
+		}); err != nil {
+			return err
+		}
+
+		reply = fmt.Sprintf("🎟️ @%s buys %s for %d$. The pot is %d$, drawn %s.", username, ticketsText(count), cost, round.Pot, lotteryTimeText(round.DrawAt))
+		return nil
+	})
+	if err != nil {
+		log.Printf("error buying lottery tickets: %v", err)
+		reply = "Error buying tickets."
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          groupID,
+		Text:            reply,
+		ReplyParameters: replyParameters(update.Message.ID),
+	})
+}
+
+// setLotteryRule handles /lottery schedule <cron> and /lottery cut <percent>
+func (c *casinoController) setLotteryRule(ctx context.Context, b BotInterface, update *models.Update, args []string) {
+	groupID := update.Message.Chat.ID
+
+	if !c.requireAdmin(ctx, b, update) {
+		return
+	}
+
+	settings, err := c.db.GetGroupSettings(groupID)
+	if err != nil {
+		log.Printf("error getting group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting settings.",
+		})
+		return
+	}
+
+	var reply string
+	switch args[0] {
+	case "schedule":
+		expr := strings.Join(args[1:], " ")
+		schedule, err := parseCron(expr)
+		if err != nil || schedule.Next(c.clock.Now()).IsZero() {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: groupID,
+				Text:   lotteryUsage,
+			})
+			return
+		}
+		settings.LotterySchedule = expr
+		reply = fmt.Sprintf("🎟️ The lottery is now drawn on %q, next %s.", expr, lotteryTimeText(schedule.Next(c.clock.Now())))
+	case "cut":
+		cut, err := strconv.ParseInt(strings.TrimSuffix(args[1], "%"), 10, 64)
+		if len(args) != 2 || err != nil || cut < 0 || cut > 100 {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: groupID,
+				Text:   lotteryUsage,
+			})
+			return
+		}
+		settings.LotteryCut = cut
+		reply = fmt.Sprintf("🎟️ The house now keeps %d%% of the lottery pot.", cut)
+	}
+
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		if err := c.db.SaveGroupSettings(tx, settings); err != nil {
+			return err
+		}
+		// The open round moves to the new schedule
+		if args[0] == "schedule" {
+			round, err := c.db.GetOpenLotteryRound(tx, groupID)
+			if err == nil {
+				next, _ := c.newLotteryRound(groupID, settings)
+				round.DrawAt = next.DrawAt
+				err = c.db.SaveLotteryRound(tx, round)
+			}
+			if err != nil && err != gorm.ErrRecordNotFound {
+				return err
+			}
+		}
+		return c.auditAdminAction(tx, update, "lottery", 0, strings.Join(args, " "))
+	}); err != nil {
+		log.Printf("error saving group settings: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error saving settings.",
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   reply,
+	})
+}
+
+// lotteryPick draws the winning ticket, counting from 0, for a seed
+func lotteryPick(seed, tickets int64) int64 {
+	return seededRand(seed).Int64N(tickets)
+}
+
+// drawLotteries draws every lottery round that has reached its draw time.
+// Winners are picked weighted by their tickets and paid the pot minus the
+// house cut; the round is kept as a record of the draw.
+func (c *casinoController) drawLotteries(ctx context.Context, b BotInterface) {
+	rounds, err := c.db.GetDueLotteryRounds(c.clock.Now())
+	if err != nil {
+		log.Printf("error getting lottery rounds: %v", err)
+		return
+	}
+
+	for _, round := range rounds {
+		// Tickets are bought through handlers holding the group's lock
+		lock := c.groupLock(round.GroupID)
+		lock.Lock()
+		text, err := c.drawLottery(&round)
+		lock.Unlock()
+		if err != nil {
+			log.Printf("error drawing lottery: %v", err)
+			continue
+		}
+
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: round.GroupID,
+			Text:   text,
+		})
+	}
+}
+
+// drawLottery picks and pays a round's winner, returning the announcement
+func (c *casinoController) drawLottery(round *LotteryRound) (string, error) {
+	settings, err := c.db.GetGroupSettings(round.GroupID)
+	if err != nil {
+		return "", err
+	}
+
+	var text string
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		tickets, err := c.db.GetLotteryTickets(tx, round.ID)
+		if err != nil {
+			return err
+		}
+		var total int64
+		for _, t := range tickets {
+			total += t.Count
+		}
+
+		round.Drawn = true
+		if total == 0 {
+			text = "🎟️ No lottery tickets were sold, so there is no draw."
+			return c.db.SaveLotteryRound(tx, round)
+		}
+
+		fair, seed, err := c.fairDraw(tx, round.GroupID, "lottery", total)
+		if err != nil {
+			return err
+		}
+		pick := lotteryPick(seed, total)
+		winner := tickets[0]
+		for _, t := range tickets {
+			if pick < t.Count {
+				winner = t
+				break
+			}
+			pick -= t.Count
+		}
+
+		cut := round.Pot * settings.LotteryCut / 100
+		round.WinnerID = winner.UserID
+		round.WinnerName = winner.Username
+		round.Payout = round.Pot - cut
+		if err := c.db.UpdateBalance(tx, LedgerEntry{
+			UserID:    winner.UserID,
+			GroupID:   round.GroupID,
+			Delta:     round.Payout,
+			Reason:    ledgerLotteryWin,
+			CreatedAt: c.clock.Now(),
+		}); err != nil {
+			return err
+		}
+
+		text = fmt.Sprintf("🎟️ Lottery draw! @%s wins %d$ with %d of %s.", winner.Username, round.Payout, winner.Count, ticketsText(total))
+		if cut > 0 {
+			text += fmt.Sprintf(" The house keeps %d$.", cut)
+		}
+		text += "\n" + verifyText(fair.ID)
+		return c.db.SaveLotteryRound(tx, round)
+	})
+	return text, err
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+const paytableUsage = "Usage: /paytable set <combo> <points> or /paytable reset. A combo is three faces like 7-7-bar, or pair-<face> for any two of a face. Faces: 7, bar, cherry, lemon."
+
+// Paytable maps combos to the points they score. Combos are either three
+// faces in reel order ("7-7-bar") or "pair-<face>" for exactly two of a face
+// in any position. Exact combos take precedence over pairs, even at 0 points.
+type Paytable map[string]int64
+
+func defaultPaytable() Paytable {
+	return Paytable{
+		"7-7-7":                100,
+		"bar-bar-bar":          50,
+		"lemon-lemon-lemon":    20,
+		"cherry-cherry-cherry": 10,
+	}
+}
+
+var slotFaceNames = map[slotFace]string{
+	barSlotFace:    "bar",
+	cherrySlotFace: "cherry",
+	lemonSlotFace:  "lemon",
+	sevenSlotFace:  "7",
+}
+
+var slotFaceEmojis = map[slotFace]string{
+	barSlotFace:    "🍫",
+	cherrySlotFace: "🍒",
+	lemonSlotFace:  "🍋",
+	sevenSlotFace:  "7️⃣",
+}
+
+func parseSlotFace(name string) (slotFace, bool) {
+	for face, n := range slotFaceNames {
+		if n == name {
+			return face, true
+		}
+	}
+	return 0, false
+}
+
+// score returns the points a spin scores under the paytable
+func (p Paytable) score(v slotMachineValue) int64 {
+	faces := []slotFace{v.left(), v.center(), v.right()}
+	names := make([]string, len(faces))
+	counts := map[slotFace]int{}
+	for i, face := range faces {
+		names[i] = slotFaceNames[face]
+		counts[face]++
+	}
+
+	if points, ok := p[strings.Join(names, "-")]; ok {
+		return points
+	}
+	for face, n := range counts {
+		if n == 2 {
+			return p["pair-"+slotFaceNames[face]]
+		}
+	}
+	return 0
+}
+
+// shadowsPair reports whether combo is an exact combo holding two of a face
+// whose pair pays, so its own points override the pair's
+func (p Paytable) shadowsPair(combo string) bool {
+	counts := map[string]int{}
+	for _, face := range strings.Split(combo, "-") {
+		counts[face]++
+	}
+	for face, n := range counts {
+		if n == 2 && p["pair-"+face] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCombo validates a combo and returns it in canonical form
+func parseCombo(combo string) (string, bool) {
+	parts := strings.Split(strings.ToLower(combo), "-")
+	if len(parts) == 2 && parts[0] == "pair" {
+		_, ok := parseSlotFace(parts[1])
+		return strings.Join(parts, "-"), ok
+	}
+	if len(parts) != 3 {
+		return "", false
+	}
+	for _, part := range parts {
+		if _, ok := parseSlotFace(part); !ok {
+			return "", false
+		}
+	}
+	return strings.Join(parts, "-"), true
+}
+
+// comboText renders a combo with face emojis
+func comboText(combo string) string {
+	parts := strings.Split(combo, "-")
+	if parts[0] == "pair" {
+		face, _ := parseSlotFace(parts[1])
+		return "Any two " + slotFaceEmojis[face]
+	}
+	var text string
+	for _, part := range parts {
+		face, _ := parseSlotFace(part)
+		text += slotFaceEmojis[face]
+	}
+	return text
+}
+
+func paytableText(p Paytable) string {
+	combos := make([]string, 0, len(p))
+	for combo, points := range p {
+		if points > 0 || p.shadowsPair(combo) {
+			combos = append(combos, combo)
+		}
+	}
+	if len(combos) == 0 {
+		return "No combos pay in this group."
+	}
+
+	sort.Slice(combos, func(i, j int) bool {
+		if p[combos[i]] != p[combos[j]] {
+			return p[combos[i]] > p[combos[j]]
+		}
+		return combos[i] < combos[j]
+	})
+
+	msg := "🎰 Paytable:"
+	for _, combo := range combos {
+		msg += fmt.Sprintf("\n%s - %d pts", comboText(combo), p[combo])
+	}
+	msg += fmt.Sprintf("\nBets pay points/%d times the bet, free spins only score the points.", slotBetDivisor)
+	return msg
+}
+
+// paytableHandler shows the group's paytable and lets admins change it
+func (c *casinoController) paytableHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	groupID := update.Message.Chat.ID
+
+	paytable, err := c.db.GetPaytable(c.db.DB, groupID)
+	if err != nil {
+		log.Printf("error getting paytable: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting paytable.",
+		})
+		return
+	}
+
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/paytable"))
+	if len(args) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   paytableText(paytable),
+		})
+		return
+	}
+
+	if !c.requireAdmin(ctx, b, update) {
+		return
+	}
+
+	switch {
+	case len(args) == 1 && args[0] == "reset":
+		paytable = nil
+	case len(args) == 3 && args[0] == "set":
+		combo, ok := parseCombo(args[1])
+		points, err := strconv.ParseInt(args[2], 10, 64)
+		if !ok || err != nil || points < 0 {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: groupID,
+				Text:   paytableUsage,
+			})
+			return
+		}
+		paytable[combo] = points
+	default:
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   paytableUsage,
+		})
+		return
+	}
+
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		if err := c.db.SavePaytable(tx, groupID, paytable); err != nil {
+			return err
+		}
+		return c.auditAdminAction(tx, update, "paytable", 0, strings.Join(args, " "))
+	}); err != nil {
+		log.Printf("error saving paytable: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error saving paytable.",
+		})
+		return
+	}
+
+	if paytable == nil {
+		paytable = defaultPaytable()
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   paytableText(paytable),
+	})
+}
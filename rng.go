@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+// seedSource hands out the entropy behind the bot's secrets, such as server
+// seeds and crash hash chains, so the simulator can make it reproducible
+type seedSource interface {
+	Seed() int64
+}
+
+type cryptoSeeds struct{}
+
+func (cryptoSeeds) Seed() int64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return int64(binary.BigEndian.Uint64(b[:]) & math.MaxInt64)
+}
+
+// seededRand returns a generator whose draws are fixed by seed
+func seededRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewPCG(uint64(seed), uint64(seed)))
+}
+
+// newSecret returns a fresh secret as 64 hex characters
+func (c *casinoController) newSecret() string {
+	sum := sha256.Sum256(binary.BigEndian.AppendUint64(nil, uint64(c.seeds.Seed())))
+	return hex.EncodeToString(sum[:])
+}
+
+// fairSeed derives a game's seed from a server seed, client seed and nonce:
+// the first 63 bits of HMAC-SHA256(server, "client:nonce")
+func fairSeed(server, client string, nonce int64) int64 {
+	mac := hmac.New(sha256.New, []byte(server))
+	fmt.Fprintf(mac, "%s:%d", client, nonce)
+	return int64(binary.BigEndian.Uint64(mac.Sum(nil)[:8]) & math.MaxInt64)
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+// rouletteWindow is how long a round takes bets before the wheel spins
+const rouletteWindow = time.Minute
+
+const rouletteUsage = "Usage: /roulette to open a round, then /roulette <amount> <bet> with a bet of 0-36, red, black, odd, even, 1st, 2nd or 3rd (dozens)"
+
+// Roulette bet kinds stored on RouletteBet.Kind
+const (
+	rouletteNumber = "number"
+	rouletteRed    = "red"
+	rouletteBlack  = "black"
+	rouletteOdd    = "odd"
+	rouletteEven   = "even"
+	rouletteDozen  = "dozen"
+)
+
+var rouletteRedNumbers = []int{1, 3, 5, 7, 9, 12, 14, 16, 18, 19, 21, 23, 25, 27, 30, 32, 34, 36}
+
+var rouletteDozens = []string{"1st", "2nd", "3rd"}
+
+// parseRouletteBet reads a bet such as "17", "red" or "2nd" into its kind
+// and number, the dozen for dozen bets
+func parseRouletteBet(s string) (kind string, number int, ok bool) {
+	s = strings.ToLower(s)
+	switch s {
+	case rouletteRed, rouletteBlack, rouletteOdd, rouletteEven:
+		return s, 0, true
+	}
+	if i := slices.Index(rouletteDozens, s); i >= 0 {
+		return rouletteDozen, i + 1, true
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 36 {
+		return "", 0, false
+	}
+	return rouletteNumber, n, true
+}
+
+func (bet *RouletteBet) String() string {
+	switch bet.Kind {
+	case rouletteNumber:
+		return strconv.Itoa(bet.Number)
+	case rouletteDozen:
+		return rouletteDozens[bet.Number-1] + " dozen"
+	}
+	return bet.Kind
+}
+
+// rouletteMultiplier returns what a bet returns per 1$ staked, stake
+// included, when the ball lands on pocket. Zero loses every outside bet.
+func rouletteMultiplier(bet *RouletteBet, pocket int) int64 {
+	if bet.Kind == rouletteNumber {
+		if bet.Number == pocket {
+			return 36
+		}
+		return 0
+	}
+	if pocket == 0 {
+		return 0
+	}
+
+	red := slices.Contains(rouletteRedNumbers, pocket)
+	switch {
+	case bet.Kind == rouletteRed && red,
+		bet.Kind == rouletteBlack && !red,
+		bet.Kind == rouletteOdd && pocket%2 == 1,
+		bet.Kind == rouletteEven && pocket%2 == 0:
+		return 2
+	case bet.Kind == rouletteDozen && (pocket-1)/12+1 == bet.Number:
+		return 3
+	}
+	return 0
+}
+
+// roulettePocket spins the wheel for a seed
+func roulettePocket(seed int64) int {
+	return seededRand(seed).IntN(37)
+}
+
+func roulettePocketText(pocket int) string {
+	switch {
+	case pocket == 0:
+		return "0 🟢"
+	case slices.Contains(rouletteRedNumbers, pocket):
+		return fmt.Sprintf("%d 🔴", pocket)
+	}
+	return fmt.Sprintf("%d ⚫", pocket)
+}
+
+// rouletteHandler opens a round, shows the open one or places a bet on it
+func (c *casinoController) rouletteHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/roulette"))
+	switch len(args) {
+	case 0:
+		c.openRoulette(ctx, b, update)
+	case 2:
+		c.placeRouletteBet(ctx, b, update, args[0], args[1])
+	default:
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   rouletteUsage,
+		})
+	}
+}
+
+func (c *casinoController) openRoulette(ctx context.Context, b BotInterface, update *models.Update) {
+	groupID := update.Message.Chat.ID
+
+	var text string
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		round, err := c.db.GetOpenRouletteRound(tx, groupID)
+		if err == gorm.ErrRecordNotFound {
+			round = &RouletteRound{
+				GroupID:  groupID,
+				ClosesAt: c.clock.Now().Add(rouletteWindow),
+			}
+			text = fmt.Sprintf("🎡 Roulette is open! Bets close in %s.\n%s", formatDuration(rouletteWindow), rouletteUsage)
+			return c.db.CreateRouletteRound(tx, round)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !c.clock.Now().Before(round.ClosesAt) {
+			text = "🎡 Bets are closed, the wheel is about to spin."
+			return nil
+		}
+
+		bets, err := c.db.GetRouletteBets(tx, round.ID)
+		if err != nil {
+			return err
+		}
+		text = fmt.Sprintf("🎡 Bets close in %s.", formatDuration(round.ClosesAt.Sub(c.clock.Now()).Round(time.Second)))
+		if len(bets) == 0 {
+			text += "\nNo bets yet."
+		}
+		for _, bet := range bets {
+			text += fmt.Sprintf("\n@%s - %d$ on %s", bet.Username, bet.Amount, &bet)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("error opening roulette: %v", err)
+		text = "Error opening roulette."
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   text,
+	})
+}
+
+func (c *casinoController) placeRouletteBet(ctx context.Context, b BotInterface, update *models.Update, amountArg, betArg string) {
+	userID := update.Message.From.ID
+	username := update.Message.From.Username
+	groupID := update.Message.Chat.ID
+
+	amount, err := strconv.ParseInt(amountArg, 10, 64)
+	kind, number, ok := parseRouletteBet(betArg)
+	if err != nil || amount <= 0 || !ok {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   rouletteUsage,
+		})
+		return
+	}
+
+	if _, err := c.db.GetOrCreateStats(userID, groupID, username); err != nil {
+		log.Printf("error getting user: %v", err)
+		return
+	}
+	if _, err := c.db.GetOrCreateBalance(userID, groupID); err != nil {
+		log.Printf("error getting balance: %v", err)
+		return
+	}
+
+	bet := &RouletteBet{
+		GroupID:  groupID,
+		UserID:   userID,
+		Username: username,
+		Kind:     kind,
+		Number:   number,
+		Amount:   amount,
+	}
+	var reply string
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		round, err := c.db.GetOpenRouletteRound(tx, groupID)
+		if err == gorm.ErrRecordNotFound {
+			reply = "No roulette round is open. Start one with /roulette."
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// The round stays open until the scheduler spins it, but betting
+		// ends at ClosesAt
+		if !c.clock.Now().Before(round.ClosesAt) {
+			reply = "🎡 Bets are closed, the wheel is about to spin."
+			return nil
+		}
+
+		balance, err := c.db.GetBalance(tx, userID, groupID)
+		if err != nil {
+			return err
+		}
+		if balance.Amount < amount {
+			reply = fmt.Sprintf("@%s, you only have %d$.", username, balance.Amount)
+			return nil
+		}
+
+		if err := c.db.UpdateBalance(tx, LedgerEntry{
+			UserID:    userID,
+			GroupID:   groupID,
+			Delta:     -amount,
+			Reason:    ledgerRouletteBet,
+			MessageID: update.Message.ID,
+			CreatedAt: c.clock.Now(),
+		}); err != nil {
+			return err
+		}
+
+		bet.RoundID = round.ID
+		reply = fmt.Sprintf("@%s bets %d$ on %s.", username, amount, bet)
+		return c.db.CreateRouletteBet(tx, bet)
+	})
+	if err != nil {
+		log.Printf("error placing roulette bet: %v", err)
+		reply = "Error placing bet."
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          groupID,
+		Text:            reply,
+		ReplyParameters: replyParameters(update.Message.ID),
+	})
+}
+
+// spinRoulette spins the wheel for every round whose betting window has
+// closed, pays the winners and posts a summary.
+func (c *casinoController) spinRoulette(ctx context.Context, b BotInterface) {
+	rounds, err := c.db.GetClosedRouletteRounds(c.clock.Now())
+	if err != nil {
+		log.Printf("error getting roulette rounds: %v", err)
+		return
+	}
+
+	for _, round := range rounds {
+		// Bets come in through handlers holding the group's lock
+		lock := c.groupLock(round.GroupID)
+		lock.Lock()
+		text, err := c.resolveRoulette(&round)
+		lock.Unlock()
+		if err != nil {
+			log.Printf("error resolving roulette round: %v", err)
+			continue
+		}
+
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: round.GroupID,
+			Text:   text,
+		})
+	}
+}
+
+// resolveRoulette pays out a round and removes it, returning the summary
+func (c *casinoController) resolveRoulette(round *RouletteRound) (string, error) {
+	var text string
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		fair, seed, err := c.fairDraw(tx, round.GroupID, "roulette", 0)
+		if err != nil {
+			return err
+		}
+		pocket := roulettePocket(seed)
+		text = fmt.Sprintf("🎡 The ball lands on %s!", roulettePocketText(pocket))
+
+		bets, err := c.db.GetRouletteBets(tx, round.ID)
+		if err != nil {
+			return err
+		}
+
+		// Winnings per player, in the order they first bet
+		var winners []int64
+		won := map[int64]int64{}
+		names := map[int64]string{}
+		for _, bet := range bets {
+			payout := bet.Amount * rouletteMultiplier(&bet, pocket)
+			if payout == 0 {
+				continue
+			}
+			if err := c.db.UpdateBalance(tx, LedgerEntry{
+				UserID:    bet.UserID,
+				GroupID:   bet.GroupID,
+				Delta:     payout,
+				Reason:    ledgerRouletteWin,
+				CreatedAt: c.clock.Now(),
+			}); err != nil {
+				return err
+			}
+			if _, ok := won[bet.UserID]; !ok {
+				winners = append(winners, bet.UserID)
+			}
+			won[bet.UserID] += payout
+			names[bet.UserID] = bet.Username
+		}
+
+		switch {
+		case len(bets) == 0:
+			text += "\nNobody placed a bet."
+		case len(winners) == 0:
+			text += "\nNo winners this time."
+		default:
+			text += "\nWinners:"
+		}
+		for _, userID := range winners {
+			text += fmt.Sprintf("\n@%s wins %d$", names[userID], won[userID])
+		}
+		text += "\n" + verifyText(fair.ID)
+		return c.db.DeleteRouletteRound(tx, round.ID)
+	})
+	return text, err
+}
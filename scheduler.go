@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+// schedulerInterval is how often the scheduler looks for due work
+const schedulerInterval = time.Second
+
+// clock abstracts the current time so the simulator can fast-forward it
+type clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// runScheduler runs due background jobs until ctx is cancelled
+func (c *casinoController) runScheduler(ctx context.Context, b BotInterface) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.runDueJobs(ctx, b)
+		}
+	}
+}
+
+// runDueJobs performs every job whose time has come according to c.clock
+func (c *casinoController) runDueJobs(ctx context.Context, b BotInterface) {
+	c.expireDuels(ctx, b)
+	c.spinRoulette(ctx, b)
+	c.drawLotteries(ctx, b)
+	c.tickCrashRounds(ctx, b)
+	c.closeTournaments(ctx, b)
+	c.sendDueMessages(ctx, b)
+	c.deleteDueMessages(ctx, b)
+}
+
+// sendDueMessages delivers scheduled messages and edits. Each is attempted
+// once; a failed delivery is logged and dropped rather than retried forever.
+func (c *casinoController) sendDueMessages(ctx context.Context, b BotInterface) {
+	due, err := c.db.GetDueMessages(c.clock.Now())
+	if err != nil {
+		log.Printf("error getting scheduled messages: %v", err)
+		return
+	}
+
+	for _, msg := range due {
+		// Handlers holding the group's lock may drop the message first,
+		// e.g. a group reset
+		lock := c.groupLock(msg.ChatID)
+		lock.Lock()
+		claimed, err := c.db.ClaimScheduledMessage(msg.ID)
+		lock.Unlock()
+		if err != nil {
+			log.Printf("error deleting scheduled message: %v", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		if msg.EditMessageID != 0 {
+			_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+				ChatID:    msg.ChatID,
+				MessageID: msg.EditMessageID,
+				Text:      msg.Text,
+			})
+		} else {
+			_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: msg.ChatID,
+				Text:   msg.Text,
+			})
+		}
+		if err != nil {
+			log.Printf("error sending scheduled message: %v", err)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+// seasonTitles are awarded to the top of the slot leaderboard when a season
+// ends
+var seasonTitles = []string{"Champion", "Runner-up", "Third place"}
+
+const seasonUsage = "Usage: /season to see the current season, /stats season:<number> [game] for a past one. Admins: /season end"
+
+func seasonTimeText(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// seasonSpanText says when a season ran
+func seasonSpanText(season *Season) string {
+	return fmt.Sprintf("%s to %s", seasonTimeText(season.StartedAt), seasonTimeText(season.EndedAt))
+}
+
+// seasonHandler shows the group's current season or lets admins end it
+func (c *casinoController) seasonHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	switch strings.TrimSpace(strings.TrimPrefix(update.Message.Text, "/season")) {
+	case "":
+		c.showSeason(ctx, b, update)
+	case "end":
+		c.endSeason(ctx, b, update)
+	default:
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   seasonUsage,
+		})
+	}
+}
+
+func (c *casinoController) showSeason(ctx context.Context, b BotInterface, update *models.Update) {
+	groupID := update.Message.Chat.ID
+
+	var standings []SeasonStats
+	last, err := c.db.GetLastSeason(c.db.DB, groupID)
+	if err == nil {
+		standings, err = c.db.GetSeasonStats(c.db.DB, last.ID)
+	}
+	if err == gorm.ErrRecordNotFound {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "🏁 Season 1 is running. Admins end it with /season end.",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error getting season: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting season.",
+		})
+		return
+	}
+
+	text := fmt.Sprintf("🏁 Season %d is running since %s.", last.Number+1, seasonTimeText(last.EndedAt))
+	text += fmt.Sprintf("\nSeason %d titles:", last.Number)
+	for _, s := range standings {
+		if s.Title == "" {
+			break
+		}
+		text += fmt.Sprintf("\n%s @%s, %s", podiumMedals[s.Rank-1], s.Username, s.Title)
+	}
+	text += fmt.Sprintf("\nFinal standings: /stats season:%d", last.Number)
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   text,
+	})
+}
+
+// endSeason closes the running season with its slot and dice leaderboards
+// as final standings and awards seasonTitles on the slot one. The next spin
+// or roll opens the next season.
+func (c *casinoController) endSeason(ctx context.Context, b BotInterface, update *models.Update) {
+	groupID := update.Message.Chat.ID
+
+	if !c.requireAdmin(ctx, b, update) {
+		return
+	}
+
+	var text string
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		season, err := c.db.GetRunningSeason(tx, groupID)
+		if err == gorm.ErrRecordNotFound {
+			text = "Nobody has played this season yet."
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		season.Ended = true
+		season.EndedAt = c.clock.Now()
+
+		stats, err := c.db.GetSeasonStats(tx, season.ID)
+		if err != nil {
+			return err
+		}
+		sortSlotStats(stats)
+		text = fmt.Sprintf("🏁 Season %d is over!", season.Number)
+		for i := range stats {
+			u := &stats[i]
+			u.Rank = i + 1
+			if i < len(seasonTitles) {
+				u.Title = fmt.Sprintf("Season %d %s", season.Number, seasonTitles[i])
+				text += fmt.Sprintf("\n%s @%s · %s · %d pts", podiumMedals[i], u.Username, u.Title, u.Score)
+			}
+		}
+		text += fmt.Sprintf("\nThe leaderboards are reset for season %d. Final standings: /stats season:%d", season.Number+1, season.Number)
+		if len(stats) > 0 {
+			if err := c.db.SaveSeasonStats(tx, stats); err != nil {
+				return err
+			}
+		}
+
+		for _, emoji := range diceGameOrder {
+			diceStats, err := c.db.GetSeasonDiceStats(tx, season.ID, emoji)
+			if err != nil {
+				return err
+			}
+			if len(diceStats) == 0 {
+				continue
+			}
+			sortDiceGameStats(diceStats)
+			for i := range diceStats {
+				diceStats[i].Rank = i + 1
+			}
+			if err := c.db.SaveSeasonDiceStats(tx, diceStats); err != nil {
+				return err
+			}
+		}
+
+		if err := c.db.SaveSeason(tx, season); err != nil {
+			return err
+		}
+		return c.auditAdminAction(tx, update, "season", 0, fmt.Sprintf("ended season %d", season.Number))
+	})
+	if err != nil {
+		log.Printf("error ending season: %v", err)
+		text = "Error ending season."
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   text,
+	})
+}
+
+// seasonStatsHandler shows an ended season's final standings,
+// /stats season:<number> [game]
+func (c *casinoController) seasonStatsHandler(ctx context.Context, b BotInterface, update *models.Update, arg string) {
+	groupID := update.Message.Chat.ID
+
+	args := strings.Fields(arg)
+	var number int
+	var err error
+	if len(args) == 1 || len(args) == 2 {
+		number, err = strconv.Atoi(args[0])
+	}
+	emoji := "🎰"
+	if len(args) == 2 {
+		emoji = args[1]
+	}
+	game, isDice := diceGames[emoji]
+	if err != nil || number <= 0 || (emoji != "🎰" && !isDice) {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   seasonUsage,
+		})
+		return
+	}
+
+	season, err := c.db.GetSeason(groupID, number)
+	if err == gorm.ErrRecordNotFound || (err == nil && !season.Ended) {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   fmt.Sprintf("Season %d hasn't ended. See /stats for the current season.", number),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error getting season: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting stats.",
+		})
+		return
+	}
+
+	var msg string
+	if isDice {
+		msg, err = c.seasonDiceStandingsText(season, &game)
+	} else {
+		msg, err = c.seasonStandingsText(season)
+	}
+	if err != nil {
+		log.Printf("error getting season stats: %v", err)
+		msg = "Error getting stats."
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   msg,
+	})
+}
+
+func (c *casinoController) seasonStandingsText(season *Season) (string, error) {
+	standings, err := c.db.GetSeasonStats(c.db.DB, season.ID)
+	if err != nil {
+		return "", err
+	}
+	if len(standings) == 0 {
+		return fmt.Sprintf("Nobody spun 🎰 in season %d.", season.Number), nil
+	}
+
+	msg := fmt.Sprintf("🏁 Season %d final standings, %s:", season.Number, seasonSpanText(season))
+	for i := range standings {
+		s := &standings[i]
+		msg += "\n" + slotStatsLine(s.Rank, s)
+		if s.Title != "" {
+			msg += " " + podiumMedals[s.Rank-1]
+		}
+	}
+	return msg, nil
+}
+
+func (c *casinoController) seasonDiceStandingsText(season *Season, game *diceGame) (string, error) {
+	standings, err := c.db.GetSeasonDiceStats(c.db.DB, season.ID, game.Emoji)
+	if err != nil {
+		return "", err
+	}
+	if len(standings) == 0 {
+		return fmt.Sprintf("Nobody played %s in season %d.", game.Emoji, season.Number), nil
+	}
+
+	msg := fmt.Sprintf("🏁 Season %d %s %s final standings, %s:", season.Number, game.Emoji, game.title(), seasonSpanText(season))
+	for i := range standings {
+		msg += "\n" + game.statsLine(standings[i].Rank, &standings[i])
+	}
+	return msg, nil
+}
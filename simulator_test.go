@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -79,7 +80,11 @@ func updateTestFile(filename string, scenarios []TestScenario, actualResponses [
 
 			// Replace old expected response with new one
 			if responseIndex < len(actualResponses) {
-				newLines = append(newLines, actualResponses[responseIndex])
+				if actualResponses[responseIndex] != "" {
+					newLines = append(newLines, actualResponses[responseIndex])
+				}
+				// Keep a blank line between scenarios
+				newLines = append(newLines, "")
 				responseIndex++
 
 				// Skip old expected response lines
@@ -95,19 +100,63 @@ func updateTestFile(filename string, scenarios []TestScenario, actualResponses [
 	return os.WriteFile(filename, []byte(strings.Join(newLines, "\n")), 0644)
 }
 
+// fakeClock is a clock the simulator advances by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.now = f.now.Add(d)
+}
+
+// fakeSeeds hands out consecutive seeds, starting wherever a "> @rng"
+// scenario last put it
+type fakeSeeds struct {
+	next int64
+}
+
+func (f *fakeSeeds) Seed() int64 {
+	f.next++
+	return f.next - 1
+}
+
 // MockBot simulates *bot.Bot for testing
 type MockBot struct {
-	messages []string
+	messages   []string
 	diceValues []int
+	admins     map[int64]bool
 }
 
 func NewMockBot() *MockBot {
 	return &MockBot{
-		messages: []string{},
+		messages:   []string{},
 		diceValues: []int{},
+		admins:     map[int64]bool{},
 	}
 }
 
+// SetAdmin makes GetChatMember report the user as a chat administrator
+func (m *MockBot) SetAdmin(userID int64) {
+	m.admins[userID] = true
+}
+
+func (m *MockBot) GetChatMember(ctx context.Context, params *bot.GetChatMemberParams) (*models.ChatMember, error) {
+	if m.admins[params.UserID] {
+		return &models.ChatMember{
+			Type:          models.ChatMemberTypeAdministrator,
+			Administrator: &models.ChatMemberAdministrator{User: models.User{ID: params.UserID}},
+		}, nil
+	}
+	return &models.ChatMember{
+		Type:   models.ChatMemberTypeMember,
+		Member: &models.ChatMemberMember{User: &models.User{ID: params.UserID}},
+	}, nil
+}
+
 func (m *MockBot) SendMessage(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error) {
 	msg := &models.Message{
 		ID:   len(m.messages) + 1,
@@ -125,11 +174,26 @@ func (m *MockBot) SendDice(ctx context.Context, params *bot.SendDiceParams) (*mo
 			Value: m.NextDiceValue(),
 		},
 	}
+	m.messages = append(m.messages, fmt.Sprintf("(dice) %s %d", msg.Dice.Emoji, msg.Dice.Value))
 	return msg, nil
 }
 
 func (m *MockBot) DeleteMessage(ctx context.Context, params *bot.DeleteMessageParams) (bool, error) {
-	// Mock implementation - just return true (deleted successfully)
+	m.messages = append(m.messages, fmt.Sprintf("(deleted) %d", params.MessageID))
+	return true, nil
+}
+
+// EditMessageText records the new text so transcripts show the edit
+func (m *MockBot) EditMessageText(ctx context.Context, params *bot.EditMessageTextParams) (*models.Message, error) {
+	m.messages = append(m.messages, "(edited) "+params.Text)
+	return &models.Message{ID: params.MessageID, Text: params.Text}, nil
+}
+
+// AnswerCallbackQuery records alerts shown to the user who pressed a button
+func (m *MockBot) AnswerCallbackQuery(ctx context.Context, params *bot.AnswerCallbackQueryParams) (bool, error) {
+	if params.Text != "" {
+		m.messages = append(m.messages, "(alert) "+params.Text)
+	}
 	return true, nil
 }
 
@@ -190,10 +254,13 @@ func parseTestInput(input string) []TestScenario {
 			username := usernameLine
 			userID := int64(0)
 
-			// Check if it's @bot (no ID needed)
+			// Check if it's @bot, @clock or @rng (no ID needed)
 			if strings.HasPrefix(usernameLine, "bot") {
 				username = "bot"
 				userID = 0
+			} else if usernameLine == "clock" || usernameLine == "rng" {
+				username = usernameLine
+				userID = 0
 			} else if strings.Contains(usernameLine, "(id=") {
 				// Parse explicit ID
 				parts := strings.Split(usernameLine, "(id=")
@@ -274,10 +341,57 @@ func runScenario(t *testing.T, scenario TestScenario, svc *casinoController) {
 	mockBot := NewMockBot()
 
 	// Create a mock update based on the scenario
+	update := newScenarioUpdate(scenario)
+
+	if strings.HasPrefix(scenario.Command, "/slots") {
+		// Handle slot machine
+		update.Message.Dice = &models.Dice{
+			Emoji: "🎰",
+			Value: 1, // Default value, can be overridden
+		}
+	}
+	dispatchCommand(ctx, svc, mockBot, update)
+
+	// Check the result
+	actual := normalizeResponse(mockBot.GetLastMessage())
+	if actual != scenario.Expected {
+		t.Errorf("Command: %s\nExpected: %q\nActual:   %q", scenario.Command, scenario.Expected, actual)
+	}
+}
+
+// newScenarioUpdate builds the update a scenario's user would send. A command
+// of the form "<dice emoji> <value>" (e.g. "🎰 64") becomes a dice message,
+// optionally prefixed with "(forwarded)", "(via bot)" or "(edited)", and
+// "[<data>]" (e.g. "[duel:accept:1]") presses the inline button with that
+// callback data.
+func newScenarioUpdate(scenario TestScenario) *models.Update {
+	if strings.HasPrefix(scenario.Command, "[") && strings.HasSuffix(scenario.Command, "]") {
+		return &models.Update{
+			ID: 1,
+			CallbackQuery: &models.CallbackQuery{
+				ID: "1",
+				From: models.User{
+					ID:       scenario.UserID,
+					Username: scenario.Username,
+				},
+				Message: models.MaybeInaccessibleMessage{
+					Type: models.MaybeInaccessibleMessageTypeMessage,
+					Message: &models.Message{
+						Chat: models.Chat{
+							ID:   1,
+							Type: models.ChatTypeGroup,
+						},
+					},
+				},
+				Data: strings.Trim(scenario.Command, "[]"),
+			},
+		}
+	}
+
 	update := &models.Update{
 		ID: 1,
 		Message: &models.Message{
-			ID:   1,
+			ID: 1,
 			From: &models.User{
 				ID:       scenario.UserID,
 				Username: scenario.Username,
@@ -290,38 +404,138 @@ func runScenario(t *testing.T, scenario TestScenario, svc *casinoController) {
 		},
 	}
 
-	// Parse command to determine which handler to call
-	command := strings.TrimSpace(strings.Fields(scenario.Command)[0])
+	command := scenario.Command
+	var origin string
+	for _, prefix := range []string{"(forwarded) ", "(via bot) ", "(edited) "} {
+		if strings.HasPrefix(command, prefix) {
+			origin = prefix
+			command = strings.TrimPrefix(command, prefix)
+		}
+	}
+
+	fields := strings.Fields(command)
+	if len(fields) == 2 && !strings.HasPrefix(fields[0], "/") {
+		var value int
+		if _, err := fmt.Sscanf(fields[1], "%d", &value); err == nil {
+			update.Message.Text = ""
+			update.Message.Dice = &models.Dice{Emoji: fields[0], Value: value}
+		}
+	}
+
+	switch origin {
+	case "(forwarded) ":
+		update.Message.ForwardOrigin = &models.MessageOrigin{
+			Type:                    models.MessageOriginTypeHiddenUser,
+			MessageOriginHiddenUser: &models.MessageOriginHiddenUser{SenderUserName: "someone"},
+		}
+	case "(via bot) ":
+		update.Message.ViaBot = &models.User{ID: 999, IsBot: true, Username: "dicebot"}
+	case "(edited) ":
+		update.EditedMessage, update.Message = update.Message, nil
+	}
+
+	return update
+}
+
+// dispatchCommand routes an update to the handler registered for it in main
+func dispatchCommand(ctx context.Context, svc *casinoController, b BotInterface, update *models.Update) {
+	if update.CallbackQuery != nil {
+		switch {
+		case strings.HasPrefix(update.CallbackQuery.Data, "duel:"):
+			svc.duelCallbackHandler(ctx, b, update)
+		case strings.HasPrefix(update.CallbackQuery.Data, "bj:"):
+			svc.blackjackCallbackHandler(ctx, b, update)
+		case strings.HasPrefix(update.CallbackQuery.Data, "hilo:"):
+			svc.hiloCallbackHandler(ctx, b, update)
+		case strings.HasPrefix(update.CallbackQuery.Data, "crash:"):
+			svc.crashCallbackHandler(ctx, b, update)
+		}
+		return
+	}
+	if update.Message == nil {
+		svc.defaultHandler(ctx, b, update)
+		return
+	}
+
+	command := ""
+	if fields := strings.Fields(update.Message.Text); len(fields) > 0 {
+		command = fields[0]
+	}
 
 	switch {
 	case command == "/stats":
-		svc.statsHandler(ctx, mockBot, update)
+		svc.statsHandler(ctx, b, update)
 	case command == "/balance":
-		svc.balanceHandler(ctx, mockBot, update)
+		svc.balanceHandler(ctx, b, update)
 	case strings.HasPrefix(command, "/duel"):
-		svc.duelHandler(ctx, mockBot, update)
+		svc.duelHandler(ctx, b, update)
 	case command == "/acceptDuel":
-		svc.acceptDuelHandler(ctx, mockBot, update)
+		svc.acceptDuelHandler(ctx, b, update)
 	case command == "/declineDuel":
-		svc.declineDuelHandler(ctx, mockBot, update)
+		svc.declineDuelHandler(ctx, b, update)
 	case command == "/cancelDuel":
-		svc.cancelDuelHandler(ctx, mockBot, update)
-	case strings.HasPrefix(command, "/slots"):
-		// Handle slot machine
-		update.Message.Dice = &models.Dice{
-			Emoji: "🎰",
-			Value: 1, // Default value, can be overridden
-		}
-		svc.defaultHandler(ctx, mockBot, update)
+		svc.cancelDuelHandler(ctx, b, update)
+	case command == "/cleanup":
+		svc.cleanupHandler(ctx, b, update)
+	case command == "/cheaters":
+		svc.cheatersHandler(ctx, b, update)
+	case command == "/addBalance":
+		svc.addBalanceHandler(ctx, b, update)
+	case command == "/setBalance":
+		svc.setBalanceHandler(ctx, b, update)
+	case command == "/resetUser":
+		svc.resetUserHandler(ctx, b, update)
+	case command == "/resetGroup":
+		svc.resetGroupHandler(ctx, b, update)
+	case command == "/bet":
+		svc.betHandler(ctx, b, update)
+	case command == "/paytable":
+		svc.paytableHandler(ctx, b, update)
+	case command == "/jackpot":
+		svc.jackpotHandler(ctx, b, update)
+	case command == "/daily":
+		svc.dailyHandler(ctx, b, update)
+	case command == "/give":
+		svc.giveHandler(ctx, b, update)
+	case command == "/blackjack":
+		svc.blackjackHandler(ctx, b, update)
+	case command == "/roulette":
+		svc.rouletteHandler(ctx, b, update)
+	case command == "/lottery":
+		svc.lotteryHandler(ctx, b, update)
+	case command == "/flip":
+		svc.flipHandler(ctx, b, update)
+	case command == "/hilo":
+		svc.hiloHandler(ctx, b, update)
+	case command == "/crash":
+		svc.crashHandler(ctx, b, update)
+	case command == "/seed":
+		svc.seedHandler(ctx, b, update)
+	case command == "/verify":
+		svc.verifyHandler(ctx, b, update)
+	case command == "/tournament":
+		svc.tournamentHandler(ctx, b, update)
+	case command == "/season":
+		svc.seasonHandler(ctx, b, update)
+	case command == "/history":
+		svc.historyHandler(ctx, b, update)
+	case command == "/checkLedger":
+		svc.checkLedgerHandler(ctx, b, update)
 	default:
-		svc.defaultHandler(ctx, mockBot, update)
+		svc.defaultHandler(ctx, b, update)
 	}
+}
 
-	// Check the result
-	actual := mockBot.GetLastMessage()
-	if actual != scenario.Expected {
-		t.Errorf("Command: %s\nExpected: %q\nActual:   %q", scenario.Command, scenario.Expected, actual)
+// normalizeResponse drops blank lines and surrounding whitespace the same way
+// parseTestInput does for expected responses
+func normalizeResponse(response string) string {
+	var lines []string
+	for _, line := range strings.Split(response, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			lines = append(lines, trimmed)
+		}
 	}
+	return strings.Join(lines, "\n")
 }
 
 // TestTxtFiles runs all tests from testdata/*.txt files
@@ -340,13 +554,17 @@ func TestTxtFiles(t *testing.T) {
 
 	for _, file := range files {
 		t.Run(filepath.Base(file), func(t *testing.T) {
-			// Open in-memory database for each test
-			db, err := OpenDB()
+			// Open a fresh database for each test
+			db, err := OpenDB(filepath.Join(t.TempDir(), "casino.db"))
 			if err != nil {
 				t.Fatalf("failed to open test database: %v", err)
 			}
 
 			svc := newCasinoController("test-token", "testbot", db)
+			clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+			svc.clock = clock
+			seeds := &fakeSeeds{next: 1}
+			svc.seeds = seeds
 
 			// Load test file
 			input, err := loadTestFile(file)
@@ -364,52 +582,59 @@ func TestTxtFiles(t *testing.T) {
 			ctx := context.Background()
 			var actualResponses []string
 
-			for _, scenario := range scenarios {
-				// Re-create the update for each scenario
-				update := &models.Update{
-					ID: 1,
-					Message: &models.Message{
-						ID:   1,
-						From: &models.User{
-							ID:       scenario.UserID,
-							Username: scenario.Username,
-						},
-						Chat: models.Chat{
-							ID:   1,
-							Type: models.ChatTypeGroup,
-						},
-						Text: scenario.Command,
-					},
-				}
+			for i, scenario := range scenarios {
+				// Only messages sent while handling this scenario count
+				sent := len(mockBot.GetMessages())
 
-				command := strings.TrimSpace(strings.Fields(scenario.Command)[0])
-
-				switch {
-				case command == "/stats":
-					svc.statsHandler(ctx, mockBot, update)
-				case command == "/balance":
-					svc.balanceHandler(ctx, mockBot, update)
-				case strings.HasPrefix(command, "/duel"):
-					svc.duelHandler(ctx, mockBot, update)
-				case command == "/acceptDuel":
-					svc.acceptDuelHandler(ctx, mockBot, update)
-				case command == "/declineDuel":
-					svc.declineDuelHandler(ctx, mockBot, update)
-				case command == "/cancelDuel":
-					svc.cancelDuelHandler(ctx, mockBot, update)
-				default:
-					svc.defaultHandler(ctx, mockBot, update)
+				if scenario.Username == "clock" {
+					// "> @clock" scenarios fast-forward time and run due jobs
+					d, err := time.ParseDuration(strings.TrimPrefix(scenario.Command, "+"))
+					if err != nil {
+						t.Fatalf("invalid clock step %q: %v", scenario.Command, err)
+					}
+					clock.Advance(d)
+					svc.runDueJobs(ctx, mockBot)
+				} else if scenario.Username == "rng" {
+					// "> @rng" scenarios pick the next seed, e.g. "seed 42"
+					if _, err := fmt.Sscanf(scenario.Command, "seed %d", &seeds.next); err != nil {
+						t.Fatalf("invalid rng step %q: %v", scenario.Command, err)
+					}
+				} else {
+					// Users named admin... administer the test group
+					if strings.HasPrefix(scenario.Username, "admin") {
+						mockBot.SetAdmin(scenario.UserID)
+					}
+
+					// Re-create the update for each scenario, numbering messages
+					// by their position in the file
+					update := newScenarioUpdate(scenario)
+					if update.Message != nil {
+						update.Message.ID = i + 1
+					}
+					if update.EditedMessage != nil {
+						update.EditedMessage.ID = i + 1
+					}
+					dispatchCommand(ctx, svc, mockBot, update)
 				}
 
-				actual := mockBot.GetLastMessage()
+				actual := strings.Join(mockBot.GetMessages()[sent:], "\n")
 				actualResponses = append(actualResponses, actual)
 
 				// If update flag is set, don't check expectations
-				if !*updateFlag && actual != scenario.Expected {
+				if !*updateFlag && normalizeResponse(actual) != scenario.Expected {
 					t.Errorf("Command: %s\nExpected: %q\nActual:   %q", scenario.Command, scenario.Expected, actual)
 				}
 			}
 
+			// Every scenario must leave balances reconciled with the ledger
+			mismatches, err := db.CheckLedger(1)
+			if err != nil {
+				t.Fatalf("failed to check ledger: %v", err)
+			}
+			for _, m := range mismatches {
+				t.Errorf("user %d has balance %d$ but ledger sums to %d$", m.UserID, m.Balance, m.Ledger)
+			}
+
 			// Update test file if flag is set
 			if *updateFlag {
 				if err := updateTestFile(file, scenarios, actualResponses); err != nil {
@@ -420,4 +645,3 @@ func TestTxtFiles(t *testing.T) {
 		})
 	}
 }
-
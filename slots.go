@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+// slotGame is the 🎰 slot machine. Every spin scores its paytable points for
+// the leaderboard, but only wagered spins pay out: a third of the score per
+// 1$ bet, so a 3$ bet on three sevens pays 100$. A cut of every bet feeds the
+// group's jackpot, which three sevens on a wagered spin win on top.
+type slotGame struct {
+	db *DB
+}
+
+func newSlotGame(db *DB) *slotGame {
+	return &slotGame{db: db}
+}
+
+func (g *slotGame) Parse(update *models.Update) (Play, bool) {
+	return parseDicePlay(update, "🎰")
+}
+
+func (g *slotGame) Resolve(tx *gorm.DB, play Play) (Outcome, error) {
+	paytable, err := g.db.GetPaytable(tx, play.GroupID)
+	if err != nil {
+		return Outcome{}, err
+	}
+	balance, err := g.db.GetBalance(tx, play.UserID, play.GroupID)
+	if err != nil {
+		return Outcome{}, err
+	}
+
+	if balance.Amount < balance.Bet {
+		return Outcome{
+			Refused: true,
+			Reply: fmt.Sprintf("@%s, your %d$ balance can't cover your %d$ bet. That spin doesn't count, lower your bet with /bet.",
+				play.Username, balance.Amount, balance.Bet),
+		}, nil
+	}
+
+	v := slotMachineValue(play.Value)
+	delta := StatsDelta{TotalGames: 1, Score: int(paytable.score(v))}
+
+	left, center, right := v.left(), v.center(), v.right()
+	if left == center && center == right {
+		switch left {
+		case barSlotFace:
+			delta.BarWins = 1
+		case cherrySlotFace:
+			delta.CherryWins = 1
+		case lemonSlotFace:
+			delta.LemonWins = 1
+		case sevenSlotFace:
+			delta.SevenWins = 1
+		default:
+			log.Printf("unexpected main.slotFace: %#v", left)
+		}
+	}
+
+	outcome := Outcome{Stats: delta, Won: delta.Score > 0}
+	entry := LedgerEntry{
+		UserID:    play.UserID,
+		GroupID:   play.GroupID,
+		MessageID: play.MessageID,
+		CreatedAt: play.At,
+	}
+	if balance.Bet == 0 {
+		return outcome, nil
+	}
+	entry.Delta, entry.Reason = -balance.Bet, ledgerSlotBet
+	outcome.Ledger = append(outcome.Ledger, entry)
+	entry.Delta, entry.Reason = balance.Bet*int64(delta.Score)/slotBetDivisor, ledgerSlotWin
+	outcome.Ledger = append(outcome.Ledger, entry)
+
+	jackpot, err := g.playJackpot(tx, play, balance.Bet, delta.SevenWins > 0)
+	if err != nil {
+		return Outcome{}, err
+	}
+	if jackpot > 0 {
+		entry.Delta, entry.Reason = jackpot, ledgerJackpot
+		outcome.Ledger = append(outcome.Ledger, entry)
+		outcome.Reply = fmt.Sprintf("💰 JACKPOT! @%s hit 7️⃣7️⃣7️⃣ and wins the %d$ pool!", play.Username, jackpot)
+	}
+	return outcome, nil
+}
+
+// playJackpot feeds the group's cut of a bet into the jackpot and, if the
+// spin hit three sevens, empties it. It returns the amount won.
+func (g *slotGame) playJackpot(tx *gorm.DB, play Play, bet int64, sevens bool) (int64, error) {
+	settings, err := g.db.GetGroupSettings(play.GroupID)
+	if err != nil {
+		return 0, err
+	}
+	pool, err := g.db.GetJackpotPool(tx, play.GroupID)
+	if err != nil {
+		return 0, err
+	}
+
+	pool.Amount += bet * settings.JackpotCut / 100
+	won := int64(0)
+	if sevens && pool.Amount > 0 {
+		won = pool.Amount
+		pool.Amount = 0
+		pool.LastWinnerID = play.UserID
+		pool.LastWinner = play.Username
+		pool.LastWonAmount = won
+		pool.LastWonAt = play.At
+	}
+	return won, g.db.SaveJackpotPool(tx, pool)
+}
+
+func (g *slotGame) SaveStats(tx *gorm.DB, play Play, delta StatsDelta) error {
+	if err := g.db.EnsureStats(tx, play.UserID, play.GroupID, play.Username); err != nil {
+		return err
+	}
+	if err := g.db.UpdateStats(tx, play.UserID, play.GroupID, play.At, delta); err != nil {
+		return err
+	}
+	if err := g.db.AddSeasonStats(tx, play.UserID, play.GroupID, play.Username, play.At, delta); err != nil {
+		return err
+	}
+
+	// Only wagered spins count in tournaments, or the entry fee would buy
+	// a race of free spins
+	balance, err := g.db.GetBalance(tx, play.UserID, play.GroupID)
+	if err != nil || balance.Bet == 0 {
+		return err
+	}
+	return g.db.AddTournamentScore(tx, play.UserID, play.GroupID, play.At, int64(delta.Score))
+}
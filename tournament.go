@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultTournamentFee is the entry fee when an admin doesn't set one
+	defaultTournamentFee = 20
+	minTournamentLength  = time.Minute
+	maxTournamentLength  = 7 * 24 * time.Hour
+)
+
+// tournamentPrizes are the percentages of the pool paid to the top three.
+// Places nobody takes, and rounding, go to the winner.
+var tournamentPrizes = []int64{50, 30, 20}
+
+// podiumMedals mark the top three of a ranking
+var podiumMedals = []string{"🥇", "🥈", "🥉"}
+
+const tournamentUsage = "Usage: /tournament to see the standings, /tournament join to enter. Admins: /tournament start <duration> [entry fee], e.g. /tournament start 1h"
+
+// sortTournamentEntries ranks entrants by score, then by who needed fewer
+// spins, then by who joined first
+func sortTournamentEntries(entries []TournamentEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Score != entries[j].Score {
+			return entries[i].Score > entries[j].Score
+		}
+		if entries[i].Spins != entries[j].Spins {
+			return entries[i].Spins < entries[j].Spins
+		}
+		return entries[i].JoinedAt.Before(entries[j].JoinedAt)
+	})
+}
+
+// tournamentPayouts splits pool between the first len(tournamentPrizes)
+// of ranked entries
+func tournamentPayouts(pool int64, entries int) []int64 {
+	payouts := make([]int64, min(entries, len(tournamentPrizes)))
+	if len(payouts) == 0 {
+		return payouts
+	}
+	rest := pool
+	for i := 1; i < len(payouts); i++ {
+		payouts[i] = pool * tournamentPrizes[i] / 100
+		rest -= payouts[i]
+	}
+	payouts[0] = rest
+	return payouts
+}
+
+// tournamentHandler shows the running tournament's standings, enters the
+// sender or lets admins start one
+func (c *casinoController) tournamentHandler(ctx context.Context, b BotInterface, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/tournament"))
+	switch {
+	case len(args) == 0:
+		c.showTournament(ctx, b, update)
+	case len(args) == 1 && args[0] == "join":
+		c.joinTournament(ctx, b, update)
+	case len(args) > 0 && args[0] == "start":
+		c.startTournament(ctx, b, update, args[1:])
+	default:
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   tournamentUsage,
+		})
+	}
+}
+
+func (c *casinoController) showTournament(ctx context.Context, b BotInterface, update *models.Update) {
+	groupID := update.Message.Chat.ID
+
+	var entries []TournamentEntry
+	t, err := c.db.GetRunningTournament(c.db.DB, groupID)
+	if err == nil {
+		entries, err = c.db.GetTournamentEntries(c.db.DB, t.ID)
+	}
+	if err == gorm.ErrRecordNotFound {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "No tournament is running. Admins start one with /tournament start <duration> [entry fee].",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error getting tournament: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   "Error getting tournament.",
+		})
+		return
+	}
+
+	sortTournamentEntries(entries)
+	payouts := tournamentPayouts(t.Pool, len(entries))
+
+	text := fmt.Sprintf("🏆 Slots tournament #%d", t.ID)
+	text += fmt.Sprintf("\nEnds in %s (%s)", formatDuration(t.EndsAt.Sub(c.clock.Now()).Round(time.Second)), lotteryTimeText(t.EndsAt))
+	text += fmt.Sprintf("\nPrize pool: %d$, entry fee %d$: /tournament join", t.Pool, t.EntryFee)
+	if len(entries) == 0 {
+		text += "\nNo entrants yet."
+	}
+	for i, e := range entries {
+		text += fmt.Sprintf("\n%d. @%s %d pts (%s)", i+1, e.Username, e.Score, spinsText(e.Spins))
+		if i < len(payouts) {
+			text += fmt.Sprintf(" · %d$", payouts[i])
+		}
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   text,
+	})
+}
+
+func (c *casinoController) joinTournament(ctx context.Context, b BotInterface, update *models.Update) {
+	userID := update.Message.From.ID
+	username := update.Message.From.Username
+	groupID := update.Message.Chat.ID
+
+	if _, err := c.db.GetOrCreateStats(userID, groupID, username); err != nil {
+		log.Printf("error getting user: %v", err)
+		return
+	}
+	if _, err := c.db.GetOrCreateBalance(userID, groupID); err != nil {
+		log.Printf("error getting balance: %v", err)
+		return
+	}
+
+	var reply string
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		t, err := c.db.GetRunningTournament(tx, groupID)
+		if err == gorm.ErrRecordNotFound || (err == nil && !c.clock.Now().Before(t.EndsAt)) {
+			reply = "No tournament is running."
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := c.db.GetTournamentEntry(tx, t.ID, userID); err != gorm.ErrRecordNotFound {
+			if err == nil {
+				reply = fmt.Sprintf("@%s, you're already in the tournament.", username)
+			}
+			return err
+		}
+
+		balance, err := c.db.GetBalance(tx, userID, groupID)
+		if err != nil {
+			return err
+		}
+		if balance.Amount < t.EntryFee {
+			reply = fmt.Sprintf("@%s, you only have %d$. The entry fee is %d$.", username, balance.Amount, t.EntryFee)
+			return nil
+		}
+
+		if err := c.db.UpdateBalance(tx, LedgerEntry{
+			UserID:    userID,
+			GroupID:   groupID,
+			Delta:     -t.EntryFee,
+			Reason:    ledgerTournamentEntry,
+			MessageID: update.Message.ID,
+			CreatedAt: c.clock.Now(),
+		}); err != nil {
+			return err
+		}
+		t.Pool += t.EntryFee
+		if err := c.db.SaveTournament(tx, t); err != nil {
+			return err
+		}
+		if err := c.db.CreateTournamentEntry(tx, &TournamentEntry{
+			TournamentID: t.ID,
+			UserID:       userID,
+			GroupID:      groupID,
+			Username:     username,
+			JoinedAt:     c.clock.Now(),
+		}); err != nil {
+			return err
+		}
+
+		reply = fmt.Sprintf("🏆 @%s joins the tournament for %d$. The prize pool is %d$. Your wagered 🎰 spins now score until %s, see /bet.", username, t.EntryFee, t.Pool, lotteryTimeText(t.EndsAt))
+		return nil
+	})
+	if err != nil {
+		log.Printf("error joining tournament: %v", err)
+		reply = "Error joining tournament."
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          groupID,
+		Text:            reply,
+		ReplyParameters: replyParameters(update.Message.ID),
+	})
+}
+
+// startTournament handles /tournament start <duration> [entry fee]
+func (c *casinoController) startTournament(ctx context.Context, b BotInterface, update *models.Update, args []string) {
+	groupID := update.Message.Chat.ID
+
+	if !c.requireAdmin(ctx, b, update) {
+		return
+	}
+
+	var length time.Duration
+	fee := int64(defaultTournamentFee)
+	var err error
+	if len(args) == 1 || len(args) == 2 {
+		length, err = time.ParseDuration(args[0])
+	}
+	if err == nil && len(args) == 2 {
+		fee, err = strconv.ParseInt(args[1], 10, 64)
+	}
+	if err != nil || length < minTournamentLength || length > maxTournamentLength || fee < 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: groupID,
+			Text:   tournamentUsage,
+		})
+		return
+	}
+
+	var reply string
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := c.db.GetRunningTournament(tx, groupID); err != gorm.ErrRecordNotFound {
+			if err == nil {
+				reply = "A tournament is already running, see /tournament."
+			}
+			return err
+		}
+
+		t := &Tournament{
+			GroupID:  groupID,
+			EntryFee: fee,
+			EndsAt:   c.clock.Now().Add(length),
+		}
+		if err := c.db.SaveTournament(tx, t); err != nil {
+			return err
+		}
+		reply = fmt.Sprintf("🏆 A %s slots tournament starts now! Enter with /tournament join for %d$, then every wagered 🎰 spin scores its paytable points until %s. The top three split the pool %s.",
+			formatDuration(length), fee, lotteryTimeText(t.EndsAt), tournamentPrizesText())
+		return c.auditAdminAction(tx, update, "tournament", 0, strings.Join(args, " "))
+	})
+	if err != nil {
+		log.Printf("error starting tournament: %v", err)
+		reply = "Error starting tournament."
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: groupID,
+		Text:   reply,
+	})
+}
+
+func spinsText(n int64) string {
+	if n == 1 {
+		return "1 spin"
+	}
+	return fmt.Sprintf("%d spins", n)
+}
+
+func tournamentPrizesText() string {
+	shares := make([]string, len(tournamentPrizes))
+	for i, p := range tournamentPrizes {
+		shares[i] = fmt.Sprintf("%d%%", p)
+	}
+	return strings.Join(shares, "/")
+}
+
+// closeTournaments ends every tournament whose time is up and pays out its
+// pool. Ended tournaments are kept as a record of the standings.
+func (c *casinoController) closeTournaments(ctx context.Context, b BotInterface) {
+	tournaments, err := c.db.GetDueTournaments(c.clock.Now())
+	if err != nil {
+		log.Printf("error getting tournaments: %v", err)
+		return
+	}
+
+	for _, t := range tournaments {
+		// Entries and spins are recorded through handlers holding the
+		// group's lock
+		lock := c.groupLock(t.GroupID)
+		lock.Lock()
+		text, err := c.closeTournament(&t)
+		lock.Unlock()
+		if err != nil {
+			log.Printf("error closing tournament: %v", err)
+			continue
+		}
+
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: t.GroupID,
+			Text:   text,
+		})
+	}
+}
+
+// closeTournament pays a tournament's prizes, returning the announcement
+func (c *casinoController) closeTournament(t *Tournament) (string, error) {
+	var text string
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		entries, err := c.db.GetTournamentEntries(tx, t.ID)
+		if err != nil {
+			return err
+		}
+
+		t.Ended = true
+		if len(entries) == 0 {
+			text = "🏆 The slots tournament is over. Nobody entered."
+			return c.db.SaveTournament(tx, t)
+		}
+
+		sortTournamentEntries(entries)
+		text = fmt.Sprintf("🏆 The slots tournament is over! %d$ in prizes:", t.Pool)
+		for i, payout := range tournamentPayouts(t.Pool, len(entries)) {
+			e := entries[i]
+			text += fmt.Sprintf("\n%s @%s wins %d$ with %d pts", podiumMedals[i], e.Username, payout, e.Score)
+			if err := c.db.UpdateBalance(tx, LedgerEntry{
+				UserID:    e.UserID,
+				GroupID:   t.GroupID,
+				Delta:     payout,
+				Reason:    ledgerTournamentPrize,
+				CreatedAt: c.clock.Now(),
+			}); err != nil {
+				return err
+			}
+		}
+		return c.db.SaveTournament(tx, t)
+	})
+	return text, err
+}